@@ -1,16 +1,184 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
 	"github.com/idkarn/curiodb/pkg/server"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		}
+	}
+
 	var port int
+	var snapshotInterval time.Duration
+	var snapshotEvery uint64
+	var txTimeout time.Duration
+	var dataDir string
 	flag.IntVar(&port, "port", 3141, "Sets the port curiodb will listening on")
+	flag.StringVar(&dataDir, "data-dir", common.DEFAULT_DATA_DIR, "Sets the directory the data is stored in")
+	flag.DurationVar(&snapshotInterval, "snapshot-interval", server.DefaultSnapshotInterval, "Sets how often a snapshot is taken, 0 disables periodic snapshots")
+	flag.Uint64Var(&snapshotEvery, "snapshot-every", server.DefaultSnapshotEvery, "Takes a snapshot after this many mutations, 0 disables it")
+	flag.DurationVar(&txTimeout, "tx-timeout", common.DEFAULT_TX_TIMEOUT, "Aborts a transaction that was not used for this long, 0 disables the timeout")
 	flag.Parse()
 
 	config := server.NewConfig(uint32(port))
+	config.DataDir = dataDir
+	config.SnapshotInterval = snapshotInterval
+	config.SnapshotEvery = snapshotEvery
+	config.TxTimeout = txTimeout
 	server.Launch(config)
 }
+
+// transferFlags are the flags shared by export and import.
+type transferFlags struct {
+	dataDir   string
+	table     string
+	format    string
+	delimiter string
+}
+
+func newTransferFlags(name string) (*flag.FlagSet, *transferFlags) {
+	set := flag.NewFlagSet("curiodb "+name, flag.ExitOnError)
+	tf := &transferFlags{}
+	set.StringVar(&tf.dataDir, "data-dir", common.DEFAULT_DATA_DIR, "Sets the directory the data is stored in")
+	set.StringVar(&tf.table, "table", "", "Sets the table by its name or id")
+	set.StringVar(&tf.format, "format", "csv", "Sets the format, one of csv, json or ndjson")
+	set.StringVar(&tf.delimiter, "delimiter", ",", "Sets the delimiter of CSV fields, tab for a tab")
+	return set, tf
+}
+
+// open opens the data directory and finds the table. The server must not be
+// running on the same directory. A directory without a MANIFEST is refused
+// rather than created, it is most likely a mistyped -data-dir.
+func (tf *transferFlags) open() (*common.DB, common.TableIdType, engine.TransferOptions, error) {
+	var opts engine.TransferOptions
+	var err error
+	if tf.table == "" {
+		return nil, 0, opts, fmt.Errorf("-table is required")
+	}
+	if opts.Format, err = engine.TransferFormatByName(tf.format); err != nil {
+		return nil, 0, opts, err
+	}
+	if opts.Delimiter, err = engine.ParseDelimiter(tf.delimiter); err != nil {
+		return nil, 0, opts, err
+	}
+
+	if _, err := os.Stat(filepath.Join(tf.dataDir, common.MANIFEST_FILE_NAME)); err != nil {
+		return nil, 0, opts, fmt.Errorf("%s is not a data directory: %w", tf.dataDir, err)
+	}
+	db, err := common.Open(tf.dataDir, common.Options{})
+	if err != nil {
+		return nil, 0, opts, err
+	}
+	tid, err := db.ResolveTable(common.ParseTableRef(tf.table))
+	if err != nil {
+		db.Close()
+		return nil, 0, opts, err
+	}
+	return db, tid, opts, nil
+}
+
+// runExport writes the rows of a table to a file or to the standard output
+// and returns the exit code.
+func runExport(args []string) int {
+	set, tf := newTransferFlags("export")
+	var out string
+	set.StringVar(&out, "out", "-", "Sets the file the rows are written to, - for the standard output")
+	set.Parse(args)
+
+	db, tid, opts, err := tf.open()
+	if err != nil {
+		return fail(err)
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if out != "-" {
+		if file, err = os.Create(out); err != nil {
+			db.Close()
+			return fail(err)
+		}
+		w = file
+	}
+
+	n, err := engine.ExportTable(db, tid, w, opts)
+	if file != nil {
+		// a failed write may only show when the file is closed
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "%d rows exported\n", n)
+	return 0
+}
+
+// runImport inserts the rows of a file or of the standard input into a
+// table and prints the result. It returns 1 when a row failed.
+func runImport(args []string) int {
+	set, tf := newTransferFlags("import")
+	var in string
+	var dryRun bool
+	set.StringVar(&in, "in", "-", "Sets the file the rows are read from, - for the standard input")
+	set.BoolVar(&dryRun, "dry-run", false, "Reports the rows that would fail validation without inserting anything")
+	batch := set.Int("batch", engine.BULK_BATCH_SIZE, "Sets how many rows are inserted at once")
+	set.Parse(args)
+
+	db, tid, opts, err := tf.open()
+	if err != nil {
+		return fail(err)
+	}
+	opts.DryRun, opts.Batch = dryRun, *batch
+
+	var r io.Reader = os.Stdin
+	if in != "-" {
+		file, err := os.Open(in)
+		if err != nil {
+			db.Close()
+			return fail(err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	result, err := engine.ImportTable(db, tid, r, opts)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	content, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(content))
+	if !result.Ok {
+		return 1
+	}
+	return 0
+}
+
+// fail prints the error and returns the exit code of a failure.
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
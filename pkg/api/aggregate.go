@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func AggregateHandler(ctx middleware.RequestContext) {
+	var data common.AggregateData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := openTx(common.Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	tid, err := common.Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data.Filter, err = engine.KeyFilter(common.Default, tx, tid, data.Filter, data.Key)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := engine.Aggregate(common.Default, tx, tid, data)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx.SendJSON(result)
+}
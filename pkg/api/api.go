@@ -1,11 +1,13 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	. "github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
 	"github.com/idkarn/curiodb/pkg/middleware"
 )
 
@@ -30,25 +32,28 @@ func NewRowHandler(ctx middleware.RequestContext) {
 		return
 	}
 
-	if data.Table >= TableIdType(len(Store.Tables)) {
-		ctx.Error(ResponseStrings["T1"], http.StatusBadRequest)
+	tx, err := openTx(Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
 		return
 	}
 
-	dataColumns := make(map[ColumnIdType]interface{})
-	for key, val := range data.Columns {
-		colIdx, err := FindColumnByName(data.Table, key)
-		if err != nil {
-			ctx.Error(err.Error(), http.StatusInternalServerError)
-			return
-		}
-		dataColumns[colIdx] = val
+	tid, err := Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dataColumns, err := prepareColumns(Default, tx, tid, data.Columns, false)
+	if err != nil {
+		sendError(ctx, err, http.StatusBadRequest)
+		return
 	}
 
 	var newRowId RowIdType
-	newRowId, err := AddNewRow(data.Table, dataColumns)
+	newRowId, err = addRow(Default, tx, tid, dataColumns)
 	if err != nil {
-		ctx.Error(err.Error(), http.StatusInternalServerError)
+		sendError(ctx, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -64,13 +69,35 @@ func GetRowHandler(ctx middleware.RequestContext) {
 		return
 	}
 
-	userRow, err := SearchForRecords(data.Table, data.Filter)
+	tx, err := openTx(Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	tid, err := Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := engine.KeyFilter(Default, tx, tid, data.Filter, data.Key)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := engine.SearchPage(Default, tx, tid, filter, data.Page, data.Fields)
 	if err != nil {
 		ctx.Error(err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	ctx.SendJSON(userRow)
+	if engine.Paged(data.Page) {
+		ctx.SendJSON(page)
+	} else {
+		ctx.SendJSON(page.Rows)
+	}
 
 	// log.Printf(fmt.Sprintf("%s\n", ResponseStrings["R0"]), -1)
 }
@@ -82,27 +109,33 @@ func NewColumnHandler(ctx middleware.RequestContext) {
 		return
 	}
 
-	if data.Table >= TableIdType(len(Store.Tables)) {
-		ctx.Error(ResponseStrings["T1"], http.StatusBadRequest)
+	tx, err := openTx(Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	tid, err := Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var colType uint8
-	switch data.Type {
-	case ColumnsTypeEnum[0]:
-		colType = 0
-	case ColumnsTypeEnum[1]:
-		colType = 1
-	case ColumnsTypeEnum[2]:
-		colType = 2
-	default:
-		ctx.Error(ResponseStrings["C1"], http.StatusBadRequest)
+	colType, err := ColumnTypeByName(data.Type)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	newColumnId, err := Store.TablesMetaData[data.Table].CreateNewColumn(data.Name, colType)
+	newColumnId, err := createColumn(Default, tx, tid, TableColumn{
+		Name:       data.Name,
+		Type:       colType,
+		IsOptional: data.Optional,
+		IsUnique:   data.Unique,
+		IsPrimary:  data.Primary,
+	})
 	if err != nil {
-		ctx.Error(err.Error(), http.StatusInternalServerError)
+		ctx.Error(err.Error(), columnErrorStatus(err))
 		return
 	}
 
@@ -116,40 +149,82 @@ func UpdateRowHandler(ctx middleware.RequestContext) {
 		return
 	}
 
-	rows, err := SearchForRecords(data.Table, data.Filter)
+	tx, err := openTx(Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	tid, err := Default.ResolveTable(data.Table)
 	if err != nil {
 		ctx.Error(err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var failed []RowIdType
-	for _, row := range rows { // FIXME: unrevertable changes
-		dataColumns := make(map[ColumnIdType]interface{})
-		for key, val := range data.Colunms {
-			colIdx, err := FindColumnByName(data.Table, key)
-			if err != nil {
-				ctx.Error(err.Error(), http.StatusBadRequest)
-				return
-			}
-			dataColumns[colIdx] = val
-		}
+	dataColumns, err := prepareColumns(Default, tx, tid, data.Colunms, true)
+	if err != nil {
+		sendError(ctx, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := engine.KeyFilter(Default, tx, tid, data.Filter, data.Key)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ids, failed, err := engine.UpdateInTx(Default, tx, tid, filter, dataColumns)
+	sendBatchResult(ctx, ids, failed, err)
+}
+
+func UpsertRowHandler(ctx middleware.RequestContext) {
+	var data UpsertData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := openTx(Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
 
-		if err := Store.Tables[data.Table].UpdateRow(row.Id, dataColumns); err != nil {
-			failed = append(failed, row.Id)
+	tid, err := Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := engine.UpsertKey(Default, tx, tid, data.On)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows := make([]map[ColumnIdType]interface{}, len(data.Rows))
+	for i, values := range data.Rows {
+		// the columns are checked in full when the row turns out to be new
+		if rows[i], err = prepareColumns(Default, tx, tid, values, true); err != nil {
+			sendError(ctx, err, http.StatusBadRequest)
+			return
 		}
 	}
 
-	if len(failed) == 0 {
-		ctx.SendJSON(map[string]any{
-			"ok":     true,
-			"failed": nil,
-		})
-	} else {
-		ctx.SendJSON(map[string]any{
-			"ok":     false,
-			"failed": failed,
-		})
+	results, err := upsertRows(Default, tx, tid, key, rows)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrUpsertKey) || errors.Is(err, ErrNoKeyValue) {
+			status = http.StatusBadRequest
+		}
+		sendError(ctx, err, status)
+		return
 	}
+
+	ctx.SendJSON(map[string]any{
+		"ok":   true,
+		"rows": results,
+	})
 }
 
 func DeleteRowHandler(ctx middleware.RequestContext) {
@@ -159,28 +234,160 @@ func DeleteRowHandler(ctx middleware.RequestContext) {
 		return
 	}
 
-	rows, err := SearchForRecords(data.Table, data.Filter)
+	tx, err := openTx(Default, data.Tx)
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	tid, err := Default.ResolveTable(data.Table)
 	if err != nil {
 		ctx.Error(err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var failed []RowIdType
-	for _, row := range rows {
-		if err := Store.Tables[data.Table].DeleteRow(row.Id); err != nil {
-			failed = append(failed, row.Id)
-		}
+	filter, err := engine.KeyFilter(Default, tx, tid, data.Filter, data.Key)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if len(failed) == 0 {
-		ctx.SendJSON(map[string]any{
-			"ok":     true,
-			"failed": nil,
-		})
-	} else {
+	ids, failed, err := engine.DeleteInTx(Default, tx, tid, filter)
+	sendBatchResult(ctx, ids, failed, err)
+}
+
+// sendBatchResult reports the outcome of an all-or-nothing batch, failed
+// lists the rows that made it abort, none of the rows were changed then.
+// Otherwise count tells how many rows were changed.
+func sendBatchResult(ctx middleware.RequestContext, rids []RowIdType, failed []RowIdType, err error) {
+	if len(failed) > 0 {
 		ctx.SendJSON(map[string]any{
 			"ok":     false,
 			"failed": failed,
 		})
+		return
+	}
+	var ferr *engine.FilterError
+	if errors.As(err, &ferr) {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		sendError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	ctx.SendJSON(map[string]any{
+		"ok":     true,
+		"failed": nil,
+		"count":  len(rids),
+	})
+}
+
+func NewTableHandler(ctx middleware.RequestContext) {
+	var data NewTable
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tid, err := Default.CreateTable(data.Name)
+	if err != nil {
+		ctx.Error(err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	ctx.Send(tid)
+}
+
+func ListTablesHandler(ctx middleware.RequestContext) {
+	ctx.SendJSON(Default.ListTables())
+}
+
+func RenameTableHandler(ctx middleware.RequestContext) {
+	var data RenameTableData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
 	}
+
+	tid, err := Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := Default.RenameTable(tid, data.Name); err != nil {
+		ctx.Error(err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	ctx.SendJSON(map[string]any{"ok": true})
+}
+
+func DropTableHandler(ctx middleware.RequestContext) {
+	var data DropTableType
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tid, err := Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := Default.DropTable(tid); err != nil {
+		ctx.Error(err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	ctx.SendJSON(map[string]any{"ok": true})
+}
+
+// sendError reports validation errors as JSON listing every offending field,
+// other errors as plain text with the given status.
+func sendError(ctx middleware.RequestContext, err error, statusCode int) {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		ctx.ErrorJSON(map[string]any{
+			"error":  ResponseStrings["V1"],
+			"fields": verr.Fields,
+		}, http.StatusBadRequest)
+		return
+	}
+	var uerr *UniqueError
+	if errors.As(err, &uerr) {
+		ctx.ErrorJSON(map[string]any{
+			"error":   ResponseStrings["U1"],
+			"code":    "U1",
+			"columns": uerr.Columns,
+			"row":     uerr.Row,
+		}, http.StatusConflict)
+		return
+	}
+	ctx.Error(err.Error(), statusCode)
+}
+
+func columnErrorStatus(err error) int {
+	switch err.Error() {
+	case ResponseStrings["T1"], ResponseStrings["C1"], ResponseStrings["C3"],
+		ResponseStrings["P2"], ResponseStrings["P3"], ResponseStrings["P4"]:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func tableErrorStatus(err error) int {
+	if errors.Is(err, ErrTableExists) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, ErrTableName) || errors.Is(err, ErrTooManyTables) || err.Error() == ResponseStrings["T1"] {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func SnapshotInfoHandler(ctx middleware.RequestContext) {
+	ctx.SendJSON(Default.LastSnapshot())
 }
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+// BulkRowResult is the id a row of a bulk insert got or why it wasn't
+// inserted.
+type BulkRowResult struct {
+	Id     *common.RowIdType   `json:"id,omitempty"`
+	Error  string              `json:"error,omitempty"`
+	Fields []common.FieldError `json:"fields,omitempty"`
+}
+
+// BulkResult has a result per row read, in the order of the body. Aborted
+// tells that the rows after the last one were not read.
+type BulkResult struct {
+	Ok       bool            `json:"ok"`
+	Inserted int             `json:"inserted"`
+	Failed   int             `json:"failed"`
+	Aborted  bool            `json:"aborted,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Rows     []BulkRowResult `json:"rows"`
+}
+
+func (r *BulkResult) fail(pos int, err error) {
+	var verr *common.ValidationError
+	if errors.As(err, &verr) {
+		r.Rows[pos] = BulkRowResult{Error: common.ResponseStrings["V1"], Fields: verr.Fields}
+	} else {
+		r.Rows[pos] = BulkRowResult{Error: err.Error()}
+	}
+	r.Failed++
+}
+
+func (r *BulkResult) insert(pos int, rid common.RowIdType) {
+	r.Rows[pos] = BulkRowResult{Id: &rid}
+	r.Inserted++
+}
+
+// BulkInsertHandler inserts the rows of the body, a JSON array or NDJSON,
+// into the table of the query string. The rows are inserted in batches of
+// the batch parameter, a row that can't be inserted is reported and
+// skipped. With abort=true the first such row stops the stream and the rows
+// of its batch are not inserted, the batches before it are. In a
+// transaction they are added to it the same way.
+func BulkInsertHandler(ctx middleware.RequestContext) {
+	params := ctx.Request.URL.Query()
+
+	var txid uint64
+	if param := params.Get("tx"); param != "" {
+		var err error
+		if txid, err = strconv.ParseUint(param, 10, 64); err != nil {
+			ctx.Error("tx must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	tx, err := openTx(common.Default, common.TxIdType(txid))
+	if err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	tid, err := common.Default.ResolveTable(common.ParseTableRef(params.Get("table")))
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	size := engine.BULK_BATCH_SIZE
+	if param := params.Get("batch"); param != "" {
+		if size, err = strconv.Atoi(param); err != nil || size < 1 || size > engine.MAX_BULK_BATCH_SIZE {
+			ctx.Error("batch must be a number from 1 to "+strconv.Itoa(engine.MAX_BULK_BATCH_SIZE), http.StatusBadRequest)
+			return
+		}
+	}
+	abort := params.Get("abort") == "true"
+
+	reader, err := engine.NewRowReader(ctx.Request.Body)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := BulkResult{Rows: []BulkRowResult{}}
+	var batch []map[common.ColumnIdType]interface{}
+	var positions []int
+	aborted := func() bool {
+		return abort && result.Failed > 0
+	}
+	flush := func() error {
+		defer func() {
+			batch, positions = batch[:0], positions[:0]
+		}()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		var ids []common.RowIdType
+		var errs []error
+		var err error
+		if tx != nil {
+			ids, errs, err = tx.InsertRows(tid, batch, abort)
+		} else {
+			ids, errs, err = common.Default.InsertRows(tid, batch, abort)
+		}
+		if err != nil {
+			return err
+		}
+		for i, err := range errs {
+			if err != nil {
+				result.fail(positions[i], err)
+			} else if ids != nil {
+				result.insert(positions[i], ids[i])
+			}
+		}
+		return nil
+	}
+
+	var flushErr error
+	for !aborted() {
+		values, err := reader.Next()
+		if err == io.EOF {
+			flushErr = flush()
+			break
+		}
+		pos := len(result.Rows)
+		result.Rows = append(result.Rows, BulkRowResult{})
+
+		var cols map[common.ColumnIdType]interface{}
+		if err == nil {
+			cols, err = prepareColumns(common.Default, tx, tid, values, false)
+		}
+		if err != nil {
+			result.fail(pos, err)
+			continue
+		}
+
+		batch = append(batch, cols)
+		positions = append(positions, pos)
+		if len(batch) == size {
+			if flushErr = flush(); flushErr != nil {
+				break
+			}
+		}
+	}
+
+	if aborted() && flushErr == nil {
+		// the rows read but not inserted along with the failed one
+		result.Aborted = true
+		for i, row := range result.Rows {
+			if row.Id == nil && row.Error == "" {
+				result.fail(i, errors.New("not inserted, the stream was aborted"))
+			}
+		}
+	}
+	sendBulkResult(ctx, result, flushErr)
+}
+
+func sendBulkResult(ctx middleware.RequestContext, result BulkResult, err error) {
+	result.Ok = err == nil && result.Failed == 0
+	if err != nil {
+		result.Error = err.Error()
+		ctx.ErrorJSON(result, http.StatusInternalServerError)
+		return
+	}
+	ctx.SendJSON(result)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func bulkInsert(t *testing.T, params, body string) (int, BulkResult) {
+	route := middleware.NewRouteInfo("POST", "/row/bulk", BulkInsertHandler)
+	rec := httptest.NewRecorder()
+	BulkInsertHandler(middleware.NewRequestContext(route, httptest.NewRequest("POST", "/row/bulk?"+params, strings.NewReader(body)), rec))
+
+	var result BulkResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil && rec.Code == http.StatusOK {
+		t.Fatalf("%s: unexpected response %q", params, rec.Body.String())
+	}
+	return rec.Code, result
+}
+
+// bulkIds lists the ids of the rows, -1 for the failed ones.
+func bulkIds(result BulkResult) []int {
+	ids := make([]int, len(result.Rows))
+	for i, row := range result.Rows {
+		ids[i] = -1
+		if row.Id != nil {
+			ids[i] = int(*row.Id)
+		}
+	}
+	return ids
+}
+
+func TestBulkInsert(t *testing.T) {
+	tests := []struct {
+		params   string
+		body     string
+		ids      []int
+		aborted  bool
+		inserted int
+	}{
+		{"table=users", `[{"name": "eve", "age": 20}, {"name": "fay"}, {"name": 1}]`, []int{4, 5, -1}, false, 2},
+		{"table=users&batch=2", "{\"name\": \"eve\"}\n\n{broken\n{\"name\": \"fay\"}\r\n[]\n{\"name\": \"gus\"}", []int{4, -1, 5, -1, 6}, false, 3},
+		{"table=users&batch=2&abort=true", "{\"name\": \"eve\"}\n{\"name\": \"fay\"}\n{\"name\": \"gus\"}\n{\"age\": 1}\n{\"name\": \"hal\"}", []int{4, 5, -1, -1}, true, 2},
+		{"table=1", `[{"name": "eve"}, {"name": "fay"}, oops, {"name": "gus"}]`, []int{4, 5, -1}, false, 2},
+		{"table=users", ``, []int{}, false, 0},
+	}
+
+	for _, test := range tests {
+		configQuery(t)
+		code, result := bulkInsert(t, test.params, test.body)
+		if code != http.StatusOK || result.Aborted != test.aborted || result.Inserted != test.inserted {
+			t.Fatalf("%s: unexpected result %d %+v", test.params, code, result)
+		}
+		if ids := bulkIds(result); !reflect.DeepEqual(ids, test.ids) {
+			t.Fatalf("%s: expected: %v, but returned %v", test.params, test.ids, ids)
+		}
+		if _, resp := runQuery(t, "SELECT name FROM users"); resp["count"] != float64(4+test.inserted) {
+			t.Fatalf("%s: expected %d rows, but returned %v", test.params, 4+test.inserted, resp)
+		}
+	}
+
+	if code, _ := bulkInsert(t, "table=users&batch=0", "[]"); code != http.StatusBadRequest {
+		t.Fatalf("expected a batch of 0 to be refused, but returned %d", code)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func NewIndexHandler(ctx middleware.RequestContext) {
+	changeIndex(ctx, common.Default.CreateIndex)
+}
+
+func DropIndexHandler(ctx middleware.RequestContext) {
+	changeIndex(ctx, common.Default.DropIndex)
+}
+
+func changeIndex(ctx middleware.RequestContext, change func(common.TableIdType, common.TableIndex) error) {
+	var data common.IndexData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tid, err := common.Default.ResolveTable(data.Table)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	index, err := indexOf(common.Default, tid, data)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := change(tid, index); err != nil {
+		sendError(ctx, err, indexErrorStatus(err))
+		return
+	}
+
+	ctx.SendJSON(map[string]any{"ok": true})
+}
+
+func indexOf(db *common.DB, tid common.TableIdType, data common.IndexData) (common.TableIndex, error) {
+	index := common.TableIndex{Unique: data.Unique}
+	if data.Kind != "" {
+		kind, err := common.IndexKindByName(data.Kind)
+		if err != nil {
+			return index, err
+		}
+		index.Kind = kind
+	}
+
+	names := data.Columns
+	if data.Column != "" {
+		if len(names) > 0 {
+			return index, errors.New("give either column or columns")
+		}
+		names = []string{data.Column}
+	}
+	for _, name := range names {
+		id, err := db.FindColumnByName(tid, name)
+		if err != nil {
+			return index, err
+		}
+		index.Columns = append(index.Columns, id)
+	}
+	return index, nil
+}
+
+func indexErrorStatus(err error) int {
+	if errors.Is(err, common.ErrIndexExists) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, common.ErrIndexNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, common.ErrWrongIndex) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func TestQueryOrderWithIndex(t *testing.T) {
+	configQuery(t)
+	queries := []string{
+		"SELECT name FROM users ORDER BY age DESC",
+		"SELECT name FROM users WHERE age > 26 ORDER BY age",
+		"SELECT name FROM users WHERE name LIKE 'ca%' ORDER BY age",
+	}
+	var expected []map[string]any
+	for _, src := range queries {
+		_, resp := runQuery(t, src)
+		expected = append(expected, resp)
+	}
+
+	if err := common.Default.CreateIndex(1, common.TableIndex{Kind: common.OrderedIndex, Columns: []common.ColumnIdType{1}}); err != nil {
+		t.Fatal(err)
+	}
+	for i, src := range queries {
+		if _, resp := runQuery(t, src); !reflect.DeepEqual(resp, expected[i]) {
+			t.Fatalf("%s: expected: %+v, but returned %+v", src, expected[i], resp)
+		}
+	}
+}
+
+func callHandler(t *testing.T, handler func(middleware.RequestContext), path string, body any) (int, string) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := middleware.NewRouteInfo("POST", path, handler)
+	rec := httptest.NewRecorder()
+	handler(middleware.NewRequestContext(route, httptest.NewRequest("POST", path, strings.NewReader(string(content))), rec))
+	return rec.Code, rec.Body.String()
+}
+
+func TestQueryUnique(t *testing.T) {
+	configQuery(t)
+	for _, src := range []string{
+		"CREATE TABLE accounts (login STRING PRIMARY KEY, email STRING NULL UNIQUE)",
+		"INSERT INTO accounts (login, email) VALUES ('al', 'al@x'), ('bo', NULL), ('cy', NULL)",
+	} {
+		if code, resp := runQuery(t, src); code != http.StatusOK {
+			t.Fatalf("%s: %v", src, resp)
+		}
+	}
+
+	for _, src := range []string{
+		"INSERT INTO accounts (login) VALUES ('al')",
+		"UPDATE accounts SET email = 'al@x' WHERE login = 'bo'",
+	} {
+		code, resp := runQuery(t, src)
+		if code != http.StatusConflict || resp["code"] != "U1" {
+			t.Fatalf("%s: expected a conflict, but returned %d %v", src, code, resp)
+		}
+	}
+}
+
+func TestKeyLookup(t *testing.T) {
+	configQuery(t)
+	if code, resp := runQuery(t, "CREATE TABLE accounts (login STRING PRIMARY KEY, age NUMBER)"); code != http.StatusOK {
+		t.Fatal(resp)
+	}
+	if code, resp := runQuery(t, "INSERT INTO accounts (login, age) VALUES ('al', 30), ('bo', 25)"); code != http.StatusOK {
+		t.Fatal(resp)
+	}
+	table := common.TableRef{Name: "accounts", ByName: true}
+
+	var get common.GetRow
+	get.Table, get.Key = table, "bo"
+	code, body := callHandler(t, GetRowHandler, "/row/get", get)
+	var rows []common.Row[string]
+	if err := json.Unmarshal([]byte(body), &rows); code != http.StatusOK || err != nil {
+		t.Fatalf("expected rows, but returned %d %s", code, body)
+	}
+	if len(rows) != 1 || rows[0].Columns["login"] != "bo" {
+		t.Fatalf("expected the row of bo, but returned %+v", rows)
+	}
+
+	var update common.UpdateRowData
+	update.Table, update.Key, update.Colunms = table, "al", map[string]any{"login": "bo"}
+	if code, body := callHandler(t, UpdateRowHandler, "/row/update", update); code != http.StatusConflict || !strings.Contains(body, `"columns":["login"]`) {
+		t.Fatalf("expected a conflict on login, but returned %d %s", code, body)
+	}
+
+	get.Table, get.Key = common.TableRef{Id: 0}, "al"
+	if code, body := callHandler(t, GetRowHandler, "/row/get", get); code != http.StatusBadRequest {
+		t.Fatalf("expected a table without a primary key to be refused, but returned %d %s", code, body)
+	}
+}
+
+func TestUpsertHandler(t *testing.T) {
+	configQuery(t)
+	if code, resp := runQuery(t, "CREATE TABLE accounts (login STRING PRIMARY KEY, email STRING NULL UNIQUE, age NUMBER NULL)"); code != http.StatusOK {
+		t.Fatal(resp)
+	}
+	table := common.TableRef{Name: "accounts", ByName: true}
+
+	upsert := common.UpsertData{Table: table, Rows: []map[string]any{
+		{"login": "al", "age": 30},
+		{"login": "al", "email": "al@x"},
+	}}
+	code, body := callHandler(t, UpsertRowHandler, "/row/upsert", upsert)
+	if code != http.StatusOK || body != `{"ok":true,"rows":[{"id":0,"inserted":true},{"id":0,"inserted":false}]}` {
+		t.Fatalf("expected al to be inserted then updated, but returned %d %s", code, body)
+	}
+
+	upsert = common.UpsertData{Table: table, On: "email", Rows: []map[string]any{{"email": "al@x", "age": 31}, {"login": "bo", "email": "bo@x"}}}
+	if code, body := callHandler(t, UpsertRowHandler, "/row/upsert", upsert); code != http.StatusOK || !strings.Contains(body, `{"id":1,"inserted":true}`) {
+		t.Fatalf("expected bo to be inserted, but returned %d %s", code, body)
+	}
+	if _, resp := runQuery(t, "SELECT login, age FROM accounts ORDER BY login"); !reflect.DeepEqual(resp["rows"], []any{[]any{"al", 31.0}, []any{"bo", nil}}) {
+		t.Fatalf("expected the rows of al and bo, but returned %v", resp)
+	}
+
+	for _, bad := range []common.UpsertData{
+		{Table: table, On: "age", Rows: []map[string]any{{"age": 1}}},
+		{Table: table, Rows: []map[string]any{{"age": 1}}},
+		{Table: table, Rows: []map[string]any{{"login": "cy"}, {"login": "bo", "email": "al@x"}}},
+	} {
+		if code, body := callHandler(t, UpsertRowHandler, "/row/upsert", bad); code == http.StatusOK {
+			t.Fatalf("%+v: expected an error, but returned %s", bad, body)
+		}
+	}
+	if _, resp := runQuery(t, "SELECT login FROM accounts WHERE login = 'cy'"); resp["count"] != 0.0 {
+		t.Fatalf("expected cy not to be inserted, but returned %v", resp)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	. "github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+	"github.com/idkarn/curiodb/pkg/middleware"
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+// QueryHandler runs a SQL statement. A SELECT answers with the selected
+// columns and rows, other statements with the number of rows they changed.
+func QueryHandler(ctx middleware.RequestContext) {
+	var data QueryData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := openTx(Default, data.Tx); err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	q, err := query.Parse(data.Query)
+	if err != nil {
+		sendQueryError(ctx, err)
+		return
+	}
+	if len(data.Args) < q.Params {
+		ctx.Error(fmt.Sprintf("query takes %d arguments, got %d", q.Params, len(data.Args)), http.StatusBadRequest)
+		return
+	}
+
+	res, err := query.Execute(engine.NewBackend(Default), data.Tx, q, data.Args)
+	if err != nil {
+		sendQueryError(ctx, err)
+		return
+	}
+
+	if _, ok := q.Statement.(*query.Select); ok {
+		names := make([]string, len(res.Columns))
+		for i, col := range res.Columns {
+			names[i] = col.Name
+		}
+		ctx.SendJSON(map[string]any{
+			"columns": names,
+			"rows":    res.Rows,
+			"count":   res.Count,
+		})
+		return
+	}
+
+	response := map[string]any{
+		"ok":    true,
+		"count": res.Count,
+	}
+	if _, ok := q.Statement.(*query.Insert); ok {
+		response["id"] = res.LastId
+	}
+	ctx.SendJSON(response)
+}
+
+// sendQueryError reports where a query is wrong as JSON, other errors the
+// way the endpoint running the same operation does.
+func sendQueryError(ctx middleware.RequestContext, err error) {
+	var perr *query.ParseError
+	if errors.As(err, &perr) {
+		ctx.ErrorJSON(map[string]any{
+			"error":  perr.Msg,
+			"line":   perr.Line,
+			"column": perr.Column,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	var aborted *TxAbortedError
+	switch {
+	case errors.As(err, &aborted), errors.Is(err, ErrTxNotFound):
+		ctx.Error(err.Error(), txErrorStatus(err))
+	case errors.Is(err, ErrTableExists):
+		ctx.Error(err.Error(), tableErrorStatus(err))
+	default:
+		sendError(ctx, err, http.StatusBadRequest)
+	}
+}
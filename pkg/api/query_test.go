@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func runQuery(t *testing.T, src string, args ...any) (int, map[string]any) {
+	body, err := json.Marshal(common.QueryData{Query: src, Args: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := middleware.NewRouteInfo("POST", "/query", QueryHandler)
+	rec := httptest.NewRecorder()
+	QueryHandler(middleware.NewRequestContext(route, httptest.NewRequest("POST", "/query", strings.NewReader(string(body))), rec))
+
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: unexpected response %q", src, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func configQuery(t *testing.T) {
+	common.Default = common.NewDB()
+	common.Default.Config(common.DatabaseStore{
+		Tables:         []common.Table{{}},
+		TablesMetaData: []common.TableMetaData{{}},
+	})
+	for _, src := range []string{
+		"CREATE TABLE users (name STRING, age NUMBER NULL)",
+		"INSERT INTO users (name, age) VALUES ('alice', 30), ('bob', 25), ('carol', NULL), ('dave', 41)",
+	} {
+		if code, resp := runQuery(t, src); code != http.StatusOK {
+			t.Fatalf("%s: %v", src, resp)
+		}
+	}
+}
+
+func TestQuerySelect(t *testing.T) {
+	configQuery(t)
+	code, resp := runQuery(t, "SELECT name, age FROM users WHERE age >= ? ORDER BY age DESC LIMIT 2", 25)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, but returned %d %v", code, resp)
+	}
+	expected := map[string]any{
+		"columns": []any{"name", "age"},
+		"rows":    []any{[]any{"dave", 41.0}, []any{"alice", 30.0}},
+		"count":   2.0,
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, resp)
+	}
+
+	_, resp = runQuery(t, "SELECT id FROM users WHERE name LIKE '_a%' ORDER BY name DESC LIMIT 5 OFFSET 1")
+	if rows := resp["rows"]; !reflect.DeepEqual(rows, []any{[]any{2.0}}) {
+		t.Fatalf("expected carol, but returned %+v", resp)
+	}
+}
+
+func TestQueryChanges(t *testing.T) {
+	configQuery(t)
+	_, resp := runQuery(t, "UPDATE users SET age = 26 WHERE age <= 25")
+	if resp["count"] != 1.0 {
+		t.Fatalf("expected 1 updated row, but returned %+v", resp)
+	}
+	_, resp = runQuery(t, "DELETE FROM users WHERE name != 'alice' AND age > 20")
+	if resp["count"] != 2.0 {
+		t.Fatalf("expected 2 deleted rows, but returned %+v", resp)
+	}
+	_, resp = runQuery(t, "SELECT name FROM users ORDER BY id")
+	expected := []any{[]any{"alice"}, []any{"carol"}}
+	if !reflect.DeepEqual(resp["rows"], expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, resp["rows"])
+	}
+}
+
+func TestQueryErrorPosition(t *testing.T) {
+	configQuery(t)
+	for src, pos := range map[string][2]float64{
+		"SELECT name\nFROM users\nWHERE agee > 1":       {3, 7},
+		"SELECT nmae FROM users":                        {1, 8},
+		"UPDATE users SET age = 1 WHERE\n  name > true": {2, 3},
+		"SELECT * FROM users ORDER BY ag":               {1, 30},
+		"SELECT * FROM users WHERE":                     {1, 26},
+	} {
+		code, resp := runQuery(t, src)
+		if code != http.StatusBadRequest || resp["line"] != pos[0] || resp["column"] != pos[1] {
+			t.Fatalf("%q: expected an error at %v, but returned %d %+v", src, pos, code, resp)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+// transferOptionsOf reads the format, delimiter, dry_run and batch
+// parameters of the query string.
+func transferOptionsOf(params url.Values) (engine.TransferOptions, error) {
+	var opts engine.TransferOptions
+	var err error
+	if opts.Format, err = engine.TransferFormatByName(params.Get("format")); err != nil {
+		return opts, err
+	}
+	if opts.Delimiter, err = engine.ParseDelimiter(params.Get("delimiter")); err != nil {
+		return opts, err
+	}
+	opts.DryRun = params.Get("dry_run") == "true"
+	if param := params.Get("batch"); param != "" {
+		if opts.Batch, err = strconv.Atoi(param); err != nil || opts.Batch < 1 || opts.Batch > engine.MAX_BULK_BATCH_SIZE {
+			return opts, errors.New("batch must be a number from 1 to " + strconv.Itoa(engine.MAX_BULK_BATCH_SIZE))
+		}
+	}
+	return opts, nil
+}
+
+var transferContentTypes = [3]string{
+	"text/csv; charset=utf-8",
+	"application/json",
+	"application/x-ndjson",
+}
+
+// EXPORT_ERROR_TRAILER is the trailer of an export that failed after its
+// rows started to be sent, when the status can't tell it anymore.
+const EXPORT_ERROR_TRAILER = "X-Export-Error"
+
+// ExportTableHandler sends the rows of the table of the query string as a
+// CSV, a JSON array or NDJSON. The rows are read before anything is sent, a
+// later error is told by the EXPORT_ERROR_TRAILER trailer.
+func ExportTableHandler(ctx middleware.RequestContext) {
+	params := ctx.Request.URL.Query()
+	tid, err := common.Default.ResolveTable(common.ParseTableRef(params.Get("table")))
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := transferOptionsOf(params)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	export, err := engine.ReadExport(common.Default, tid)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header().Set("Content-Type", transferContentTypes[opts.Format])
+	ctx.Response.Header().Set("Trailer", EXPORT_ERROR_TRAILER)
+	if _, err := export.Write(ctx.Response, opts); err != nil {
+		log.Printf("Export failed: %s\n", err)
+		ctx.Response.Header().Set(EXPORT_ERROR_TRAILER, err.Error())
+	}
+}
+
+// ImportTableHandler inserts the rows of the body into the table of the
+// query string, see engine.ImportTable. With dry_run=true the rows are only
+// validated.
+func ImportTableHandler(ctx middleware.RequestContext) {
+	params := ctx.Request.URL.Query()
+	tid, err := common.Default.ResolveTable(common.ParseTableRef(params.Get("table")))
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := transferOptionsOf(params)
+	if err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := engine.ImportTable(common.Default, tid, ctx.Request.Body, opts)
+	if errors.Is(err, engine.ErrBadInput) {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		result.Ok, result.Error = false, err.Error()
+		ctx.ErrorJSON(result, http.StatusInternalServerError)
+		return
+	}
+	ctx.SendJSON(result)
+}
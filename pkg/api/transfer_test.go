@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func TestTransferHandlers(t *testing.T) {
+	configQuery(t)
+	route := middleware.NewRouteInfo("GET", "/table/export", ExportTableHandler)
+	rec := httptest.NewRecorder()
+	ExportTableHandler(middleware.NewRequestContext(route, httptest.NewRequest("GET", "/table/export?table=users&delimiter=tab", nil), rec))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "id\tname\tage\n0\talice\t30\n") {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Body.String())
+	}
+	exported := rec.Body.String()
+
+	for _, test := range []struct {
+		params string
+		code   int
+		read   int
+	}{
+		{"table=users&delimiter=tab&dry_run=true", http.StatusOK, 4},
+		{"table=users&delimiter=tab", http.StatusOK, 4},
+		{"table=users&format=xml", http.StatusBadRequest, 0},
+		{"table=users&delimiter=%22", http.StatusBadRequest, 0},
+		{"table=users&batch=0", http.StatusBadRequest, 0},
+		{"table=nope", http.StatusBadRequest, 0},
+		{"table=users", http.StatusBadRequest, 0},
+	} {
+		route := middleware.NewRouteInfo("POST", "/table/import", ImportTableHandler)
+		rec := httptest.NewRecorder()
+		ImportTableHandler(middleware.NewRequestContext(route, httptest.NewRequest("POST", "/table/import?"+test.params, strings.NewReader(exported)), rec))
+
+		var result engine.ImportResult
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("%s: unexpected response %q", test.params, rec.Body.String())
+			}
+		}
+		if rec.Code != test.code || result.Read != test.read {
+			t.Fatalf("%s: unexpected response %d %q", test.params, rec.Code, rec.Body.String())
+		}
+	}
+
+	var count int
+	common.Default.ReadTable(1, func(table *common.Table, _ *common.TableMetaData) error {
+		count = len(table.Rows)
+		return nil
+	})
+	if count != 8 {
+		t.Fatalf("expected: 8 rows, but returned %d", count)
+	}
+}
+
+// brokenWriter is a response whose client went away.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w brokenWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestExportHandlerErrors(t *testing.T) {
+	configQuery(t)
+	route := middleware.NewRouteInfo("GET", "/table/export", ExportTableHandler)
+	rec := httptest.NewRecorder()
+	ExportTableHandler(middleware.NewRequestContext(route, httptest.NewRequest("GET", "/table/export?table=users", nil), brokenWriter{rec}))
+	if rec.Header().Get("Trailer") != EXPORT_ERROR_TRAILER || rec.Header().Get(EXPORT_ERROR_TRAILER) != "connection reset" {
+		t.Fatalf("expected the error in the trailer, but returned %+v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	ExportTableHandler(middleware.NewRequestContext(route, httptest.NewRequest("GET", "/table/export?table=9", nil), rec))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Trailer") != "" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	. "github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func TxBeginHandler(ctx middleware.RequestContext) {
+	tx := Default.Transactions.Begin()
+	ctx.Send(tx.Id)
+}
+
+func TxCommitHandler(ctx middleware.RequestContext) {
+	var data TxData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := Default.Transactions.Commit(data.Tx); err != nil {
+		sendError(ctx, err, txErrorStatus(err))
+		return
+	}
+
+	ctx.SendJSON(map[string]any{"ok": true})
+}
+
+func TxRollbackHandler(ctx middleware.RequestContext) {
+	var data TxData
+	if err := ctx.Read(&data); err != nil {
+		ctx.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := Default.Transactions.Rollback(data.Tx); err != nil {
+		ctx.Error(err.Error(), txErrorStatus(err))
+		return
+	}
+
+	ctx.SendJSON(map[string]any{"ok": true})
+}
+
+func txErrorStatus(err error) int {
+	var aborted *TxAbortedError
+	if errors.As(err, &aborted) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, ErrTxNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// openTx returns the transaction a request refers to, nil if it has none.
+func openTx(db *DB, id TxIdType) (*Tx, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	return db.Transactions.Get(id)
+}
+
+func prepareColumns(db *DB, tx *Tx, tid TableIdType, values map[string]interface{}, partial bool) (map[ColumnIdType]interface{}, error) {
+	if tx == nil {
+		return db.PrepareColumns(tid, values, partial)
+	}
+	return tx.PrepareColumns(tid, values, partial)
+}
+
+func addRow(db *DB, tx *Tx, tid TableIdType, cols map[ColumnIdType]interface{}) (RowIdType, error) {
+	if tx == nil {
+		return db.AddNewRow(tid, cols)
+	}
+	return tx.AddRow(tid, cols)
+}
+
+func createColumn(db *DB, tx *Tx, tid TableIdType, col TableColumn) (ColumnIdType, error) {
+	if tx == nil {
+		return db.AddColumn(tid, col)
+	}
+	return tx.AddColumn(tid, col)
+}
+
+func upsertRows(db *DB, tx *Tx, tid TableIdType, key ColumnIdType, rows []map[ColumnIdType]interface{}) ([]UpsertResult, error) {
+	if tx == nil {
+		return db.UpsertRows(tid, key, rows)
+	}
+	return tx.UpsertRows(tid, key, rows)
+}
@@ -0,0 +1,165 @@
+package common
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"sync"
+	"time"
+)
+
+// DB is a database with its own tables, data directory and log. Any number
+// of them can be open in a process as long as their directories differ.
+type DB struct {
+	Store DatabaseStore
+
+	// Journal is the log every mutation is appended to before it is applied.
+	// While it is nil (e.g. during replay or in tests) nothing is logged.
+	Journal *WriteAheadLog
+	// Disk is the data directory the store is persisted to.
+	Disk         *Storage
+	Snapshots    *Snapshotter
+	Transactions *TxManager
+
+	// catalogLock guards the list of tables and their metadata. Row operations
+	// hold it for reading and lock just their table, schema changes and
+	// snapshots hold it exclusively and see every table in a consistent state.
+	catalogLock sync.RWMutex
+	// snapshotLock lets one snapshot run at a time, from encoding the store
+	// to truncating the log.
+	snapshotLock sync.Mutex
+
+	lastSnapshot     SnapshotInfo
+	lastSnapshotLock sync.Mutex
+	// openedLSN is the last record of the log when it was opened, Close
+	// takes no snapshot if nothing was logged since.
+	openedLSN uint64
+}
+
+// Default is the database served over HTTP.
+var Default = NewDB()
+
+type Options struct {
+	SnapshotInterval time.Duration // 0 disables periodic snapshots
+	SnapshotEvery    uint64        // 0 disables snapshots after a number of mutations
+	TxTimeout        time.Duration // 0 disables the timeout of transactions
+}
+
+func DefaultOptions() Options {
+	return Options{
+		SnapshotInterval: DEFAULT_SNAPSHOT_INTERVAL,
+		SnapshotEvery:    DEFAULT_SNAPSHOT_EVERY,
+		TxTimeout:        DEFAULT_TX_TIMEOUT,
+	}
+}
+
+// NewDB returns an empty database that is kept in memory only.
+func NewDB() *DB {
+	db := &DB{}
+	db.Transactions = NewTxManager(db, DEFAULT_TX_TIMEOUT)
+	return db
+}
+
+// Open loads the database kept in dir, creating it if there is none yet, and
+// replays the log written after the last snapshot.
+func Open(dir string, opts Options) (*DB, error) {
+	storage, err := OpenStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewDB()
+	db.Disk = storage
+
+	data, err := db.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		storage.Close()
+		return nil, err
+	}
+	if err == nil {
+		log.Println("Data was successsfully loaded")
+		db.Config(DatabaseStore{
+			Tables:         data.Tables,
+			TablesMetaData: data.TablesMetaData,
+		})
+	} else {
+		log.Println("No data was found, a new store is created")
+		db.Config(DatabaseStore{
+			Tables: []Table{
+				{},
+			},
+			TablesMetaData: []TableMetaData{
+				{},
+			},
+		})
+	}
+
+	journal, err := OpenLog(storage.LogPath())
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+	apply := db.ApplyLogRecord
+	if data.positionalLog {
+		apply = newPositionalReplay(db).apply
+	}
+	count, err := journal.Replay(data.LSN, apply)
+	if err != nil {
+		journal.Close()
+		storage.Close()
+		return nil, err
+	}
+	if count > 0 {
+		log.Printf("%d records were replayed from the log\n", count)
+	}
+	db.Journal = journal
+
+	if data.positionalLog {
+		// records appended from now on address rows by id, the old ones
+		// must not be replayed again after them
+		if _, err := db.TakeSnapshot(); err != nil {
+			journal.Close()
+			storage.Close()
+			return nil, err
+		}
+	}
+
+	db.openedLSN = journal.LSN()
+
+	db.Snapshots = NewSnapshotter(db, opts.SnapshotInterval, opts.SnapshotEvery)
+	db.Snapshots.Start()
+
+	db.Transactions = NewTxManager(db, opts.TxTimeout)
+	db.Transactions.Start()
+
+	return db, nil
+}
+
+// Close takes a final snapshot and releases the data directory. Open
+// transactions are not committed, the same as a rollback. A database that
+// was only read since Open is left as it was.
+func (db *DB) Close() error {
+	db.Transactions.Stop()
+	if db.Snapshots != nil {
+		db.Snapshots.Stop()
+	}
+
+	var err error
+	if db.Journal == nil || db.Journal.LSN() != db.openedLSN {
+		err = db.Dump()
+	}
+	if errors.Is(err, ErrNoStorage) {
+		err = nil
+	}
+	if db.Journal != nil {
+		if cerr := db.Journal.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if db.Disk != nil {
+		if cerr := db.Disk.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
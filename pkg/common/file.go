@@ -6,38 +6,41 @@ import (
 	"os"
 )
 
-func NewFile(path string) File {
-	desc, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, os.ModeAppend)
+func NewFile(path string) (File, error) {
+	desc, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		return File{}, err
 	}
 	return File{
 		Path:     path,
 		Desc:     desc,
 		Content:  nil,
 		IsOpened: true,
-	}
+	}, nil
 }
 
 var ErrClosedFile error = errors.New("File is closed")
 
-func (f *File) Close() {
+func (f *File) Close() error {
 	if f.IsOpened {
 		if err := f.Desc.Close(); err != nil {
-			panic(err)
+			return err
 		}
 		f.IsOpened = false
 	}
+	return nil
 }
 
 func (f *File) ReadBytes() ([]byte, error) {
 	if !f.IsOpened {
 		return nil, ErrClosedFile
 	}
-	f.Desc.Seek(0, 0)
+	if _, err := f.Desc.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
 	bytes, err := io.ReadAll(f.Desc)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	f.Content = bytes
 	return bytes, nil
@@ -48,23 +51,19 @@ func (f File) WriteBytes(bytes []byte) error {
 		return ErrClosedFile
 	}
 	if err := f.Desc.Truncate(0); err != nil {
-		panic(err)
+		return err
 	}
-	f.Append(bytes)
-	return nil
+	if _, err := f.Desc.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.Append(bytes); err != nil {
+		return err
+	}
+	return f.Desc.Sync()
 }
 
 func (f File) WriteString(content string) error {
-	if !f.IsOpened {
-		return ErrClosedFile
-	}
-	if err := f.Desc.Truncate(0); err != nil {
-		panic(err)
-	}
-	if _, err := f.Desc.WriteString(content); err != nil {
-		panic(err)
-	}
-	return nil
+	return f.WriteBytes([]byte(content))
 }
 
 func (f File) Append(bytes []byte) error {
@@ -72,7 +71,7 @@ func (f File) Append(bytes []byte) error {
 		return ErrClosedFile
 	}
 	if _, err := f.Desc.Write(bytes); err != nil {
-		panic(err)
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	FILTER_AND = "$and"
+	FILTER_OR  = "$or"
+	FILTER_NOT = "$not"
+)
+
+// FilterExpr is a filter document. Fields hold conditions in the prefix
+// operator form of FilterType, they all must hold along with the groups:
+//
+//	{"name": ["<a"], "$or": [{"age": [">60"]}, {"$not": {"admin": ["=true"]}}]}
+type FilterExpr struct {
+	Fields FilterType
+	And    []FilterExpr
+	Or     []FilterExpr
+	Not    *FilterExpr
+}
+
+// Where makes a filter document of the shorthand form.
+func Where(fields FilterType) FilterExpr {
+	return FilterExpr{Fields: fields}
+}
+
+func (f *FilterExpr) UnmarshalJSON(data []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	*f = FilterExpr{}
+	for key, raw := range doc {
+		var err error
+		switch {
+		case key == FILTER_AND:
+			err = json.Unmarshal(raw, &f.And)
+		case key == FILTER_OR:
+			err = json.Unmarshal(raw, &f.Or)
+		case key == FILTER_NOT:
+			f.Not = &FilterExpr{}
+			err = json.Unmarshal(raw, f.Not)
+		case strings.HasPrefix(key, "$"):
+			err = fmt.Errorf("unknown filter operator %q", key)
+		default:
+			var conds []string
+			if err = json.Unmarshal(raw, &conds); err == nil {
+				if f.Fields == nil {
+					f.Fields = FilterType{}
+				}
+				f.Fields[key] = conds
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FilterExpr) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]any, len(f.Fields)+3)
+	for field, conds := range f.Fields {
+		doc[field] = conds
+	}
+	if f.And != nil {
+		doc[FILTER_AND] = f.And
+	}
+	if f.Or != nil {
+		doc[FILTER_OR] = f.Or
+	}
+	if f.Not != nil {
+		doc[FILTER_NOT] = f.Not
+	}
+	return json.Marshal(doc)
+}
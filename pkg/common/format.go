@@ -0,0 +1,232 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+)
+
+// Snapshot file header, followed by the gob encoded payload:
+//
+//	| magic [8]byte | version uint16 | reserved uint16 | length uint64 | crc32 uint32 |
+var formatMagic = [8]byte{'C', 'U', 'R', 'I', 'O', 'D', 'B', 0}
+
+const formatHeaderSize = 24
+
+// Version of the snapshot payload written by this build:
+//
+//	0  headerless []Table, metadata kept apart in metadata.bin
+//	1  Snapshot with the LSN it covers
+//	2  rows keep ids from a per-table sequence instead of their position
+const FORMAT_VERSION uint16 = 2
+
+var ErrCorruptedSnapshot = errors.New("snapshot is corrupted")
+
+// Migration upgrades a payload of one format version to the next one.
+type Migration func(payload []byte, storage *Storage) ([]byte, error)
+
+var migrations = map[uint16]Migration{}
+
+// RegisterMigration sets how payloads of version `from` are turned into `from+1`.
+func RegisterMigration(from uint16, fn Migration) {
+	if _, ok := migrations[from]; ok {
+		panic(fmt.Sprintf("migration from version %d is already registered", from))
+	}
+	migrations[from] = fn
+}
+
+func init() {
+	RegisterMigration(0, migrateSplitMetadata)
+	RegisterMigration(1, migrateStableRowIds)
+}
+
+func encodeSnapshotFile(snap Snapshot) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(snap); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, formatHeaderSize, formatHeaderSize+payload.Len())
+	copy(out[0:8], formatMagic[:])
+	binary.LittleEndian.PutUint16(out[8:10], FORMAT_VERSION)
+	binary.LittleEndian.PutUint64(out[12:20], uint64(payload.Len()))
+	binary.LittleEndian.PutUint32(out[20:24], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(out, payload.Bytes()...), nil
+}
+
+// decodeSnapshotFile reads a snapshot of any known version and upgrades it
+// to the current one on the fly.
+func decodeSnapshotFile(content []byte, storage *Storage) (Snapshot, error) {
+	version, payload, err := splitSnapshotFile(content)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if version > FORMAT_VERSION {
+		return Snapshot{}, fmt.Errorf("snapshot format version %d is newer than supported %d", version, FORMAT_VERSION)
+	}
+
+	original := version
+	if version < FORMAT_VERSION {
+		log.Printf("Snapshot is migrated from format version %d to %d\n", version, FORMAT_VERSION)
+	}
+	for ; version < FORMAT_VERSION; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return Snapshot{}, fmt.Errorf("no migration from snapshot format version %d", version)
+		}
+		if payload, err = migrate(payload, storage); err != nil {
+			return Snapshot{}, fmt.Errorf("migration from format version %d failed: %w", version, err)
+		}
+	}
+
+	var snap Snapshot
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+		return Snapshot{}, err
+	}
+	snap.positionalLog = original < 2
+	return snap, nil
+}
+
+func splitSnapshotFile(content []byte) (uint16, []byte, error) {
+	if len(content) < formatHeaderSize || !bytes.Equal(content[0:8], formatMagic[:]) {
+		return detectHeaderlessVersion(content), content, nil
+	}
+
+	version := binary.LittleEndian.Uint16(content[8:10])
+	length := binary.LittleEndian.Uint64(content[12:20])
+	sum := binary.LittleEndian.Uint32(content[20:24])
+
+	payload := content[formatHeaderSize:]
+	if uint64(len(payload)) != length || crc32.ChecksumIEEE(payload) != sum {
+		return 0, nil, ErrCorruptedSnapshot
+	}
+	return version, payload, nil
+}
+
+// files written before the header was introduced are told apart by their content
+func detectHeaderlessVersion(content []byte) uint16 {
+	var snap Snapshot
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&snap); err == nil {
+		return 1
+	}
+	return 0
+}
+
+func migrateSplitMetadata(payload []byte, storage *Storage) ([]byte, error) {
+	var tables []Table
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&tables); err != nil {
+		return nil, err
+	}
+
+	metadata, err := ReadConfigFile[[]TableMetaData](storage.Path(LEGACY_METADATA_FILE_NAME))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	err = gob.NewEncoder(&out).Encode(Snapshot{
+		Tables:         tables,
+		TablesMetaData: metadata,
+	})
+	return out.Bytes(), err
+}
+
+// Version 1 assigned ids from the number of rows, so they could repeat after a
+// delete. Rows are renumbered by position, which is how that version addressed
+// them, and the log written after the snapshot is replayed by positionalReplay.
+func migrateStableRowIds(payload []byte, storage *Storage) ([]byte, error) {
+	var snap Snapshot
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+		return nil, err
+	}
+
+	for i := range snap.Tables {
+		table := &snap.Tables[i]
+		for pos := range table.Rows {
+			table.Rows[pos].Id = RowIdType(pos)
+		}
+		table.NextRowId = RowIdType(len(table.Rows))
+	}
+
+	var out bytes.Buffer
+	err := gob.NewEncoder(&out).Encode(snap)
+	return out.Bytes(), err
+}
+
+// positionalReplay applies the log records written along with a snapshot
+// older than version 2. They gave an inserted row the next position as id
+// and addressed updated and deleted rows by position, which is turned into
+// the ids migrateStableRowIds gave the rows.
+type positionalReplay struct {
+	db  *DB
+	ids map[TableIdType][]RowIdType // of the live rows, in the order of the table
+}
+
+func newPositionalReplay(db *DB) *positionalReplay {
+	return &positionalReplay{db: db, ids: map[TableIdType][]RowIdType{}}
+}
+
+func (r *positionalReplay) rows(tid TableIdType) []RowIdType {
+	if ids, ok := r.ids[tid]; ok {
+		return ids
+	}
+	ids := []RowIdType{}
+	r.db.ReadTable(tid, func(table *Table, _ *TableMetaData) error {
+		for _, row := range table.Rows {
+			if !row.Deleted {
+				ids = append(ids, row.Id)
+			}
+		}
+		return nil
+	})
+	return ids
+}
+
+func (r *positionalReplay) apply(rec LogRecord) error {
+	switch rec.Op {
+	case LogInsertRow:
+		ids := r.rows(rec.Table)
+		if err := r.db.ReadTable(rec.Table, func(table *Table, _ *TableMetaData) error {
+			rec.Row = table.NextRowId
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := r.db.ApplyLogRecord(rec); err != nil {
+			return err
+		}
+		r.ids[rec.Table] = append(ids, rec.Row)
+		return nil
+	case LogUpdateRow, LogDeleteRow:
+		ids := r.rows(rec.Table)
+		pos := int(rec.Row)
+		if pos >= len(ids) {
+			return fmt.Errorf("no row at position %d of table %d", pos, rec.Table)
+		}
+		rec.Row = ids[pos]
+		if err := r.db.ApplyLogRecord(rec); err != nil {
+			return err
+		}
+		if rec.Op == LogDeleteRow {
+			ids = append(ids[:pos:pos], ids[pos+1:]...)
+		}
+		r.ids[rec.Table] = ids
+		return nil
+	case LogDropTable:
+		delete(r.ids, rec.Table)
+	}
+	return r.db.ApplyLogRecord(rec)
+}
+
+func readSnapshotFile(storage *Storage) (Snapshot, error) {
+	content, err := os.ReadFile(storage.SnapshotPath())
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return decodeSnapshotFile(content, storage)
+}
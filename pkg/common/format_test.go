@@ -0,0 +1,161 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		LSN: 7,
+		Tables: []Table{{
+			Id: 0,
+			Rows: []Row[ColumnIdType]{
+				{Id: 0, Columns: map[ColumnIdType]interface{}{0: "none", 1: 42.0}},
+			},
+			NextRowId: 1,
+		}},
+		TablesMetaData: []TableMetaData{{
+			Id: 0,
+			Columns: []TableColumn{
+				{Id: 0, Name: "name", Type: 1},
+				{Id: 1, Name: "age", Type: 0},
+			},
+		}},
+	}
+}
+
+func openTestStorage(t *testing.T) *Storage {
+	s, err := OpenStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	s := openTestStorage(t)
+	content, err := encodeSnapshotFile(testSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := decodeSnapshotFile(content, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snap, testSnapshot()) {
+		t.Fatalf("expected: %+v, but returned %+v", testSnapshot(), snap)
+	}
+}
+
+func TestSnapshotFileCorrupted(t *testing.T) {
+	s := openTestStorage(t)
+	content, _ := encodeSnapshotFile(testSnapshot())
+	content[len(content)-1] ^= 0xff
+	if _, err := decodeSnapshotFile(content, s); !errors.Is(err, ErrCorruptedSnapshot) {
+		t.Fatalf("expected corruption to be detected, but returned %v", err)
+	}
+}
+
+func TestSnapshotFileNewerVersion(t *testing.T) {
+	s := openTestStorage(t)
+	content, _ := encodeSnapshotFile(testSnapshot())
+	binary.LittleEndian.PutUint16(content[8:10], FORMAT_VERSION+1)
+	if _, err := decodeSnapshotFile(content, s); err == nil {
+		t.Fatal("expected a newer format version to be refused")
+	}
+}
+
+func TestSnapshotMigrationFromSplitFiles(t *testing.T) {
+	s := openTestStorage(t)
+	expected := testSnapshot()
+	expected.LSN = 0
+	expected.positionalLog = true
+
+	for name, data := range map[string]any{
+		s.SnapshotPath():                  expected.Tables,
+		s.Path(LEGACY_METADATA_FILE_NAME): expected.TablesMetaData,
+	} {
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(f, data); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	snap, err := readSnapshotFile(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snap, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, snap)
+	}
+}
+
+func TestPositionalLogMigration(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// version 1 gave ids from the number of rows, they repeat after a delete
+	snap := testSnapshot()
+	snap.LSN = 0
+	snap.Tables[0].Rows = []Row[ColumnIdType]{
+		{Id: 0, Columns: map[ColumnIdType]interface{}{0: "a"}},
+		{Id: 1, Columns: map[ColumnIdType]interface{}{0: "b"}},
+		{Id: 1, Columns: map[ColumnIdType]interface{}{0: "c"}},
+	}
+	content, _ := encodeSnapshotFile(snap)
+	binary.LittleEndian.PutUint16(content[8:10], 1)
+	if err := os.WriteFile(s.SnapshotPath(), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wal := openTestLog(t, s.LogPath())
+	replayAll(t, wal, 0)
+	for _, rec := range []LogRecord{
+		{Op: LogDeleteRow, Row: 0},
+		{Op: LogInsertRow, Row: 2, Columns: map[ColumnIdType]interface{}{0: "d", 1: 1.0}},
+		{Op: LogUpdateRow, Row: 1, Columns: map[ColumnIdType]interface{}{0: "C"}},
+		{Op: LogDeleteRow, Row: 0},
+	} {
+		if err := wal.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wal.Close()
+	s.Close()
+
+	expected := []Row[ColumnIdType]{
+		{Id: 2, Columns: map[ColumnIdType]interface{}{0: "C"}},
+		{Id: 3, Columns: map[ColumnIdType]interface{}{0: "d", 1: 1.0}},
+	}
+	for i := 0; i < 2; i++ {
+		db, err := Open(dir, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []Row[ColumnIdType]
+		db.ReadTable(0, func(table *Table, _ *TableMetaData) error {
+			for _, row := range table.Rows {
+				if !row.Deleted {
+					rows = append(rows, row)
+				}
+			}
+			return nil
+		})
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Fatalf("expected: %+v, but returned %+v", expected, rows)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrIndexExists = errors.New(ResponseStrings["I1"])
+var ErrIndexNotFound = errors.New(ResponseStrings["I2"])
+var ErrWrongIndex = errors.New(ResponseStrings["I4"])
+
+var IndexKindsEnum = [2]string{
+	"hash",
+	"ordered",
+}
+
+// index kinds, indexes of IndexKindsEnum
+const (
+	HashIndex uint8 = iota
+	OrderedIndex
+)
+
+func IndexKindByName(name string) (uint8, error) {
+	for idx, kind := range IndexKindsEnum {
+		if kind == name {
+			return uint8(idx), nil
+		}
+	}
+	return 0, fmt.Errorf(ResponseStrings["I3"])
+}
+
+// TableIndex describes an index kept on columns of the table. A hash index
+// is on a single column, an ordered one keeps rows sorted by the values of
+// its columns in turn. A unique index refuses rows holding the same values
+// as another row, rows missing one of the values are not compared.
+type TableIndex struct {
+	Kind    uint8          `json:"kind"`
+	Columns []ColumnIdType `json:"columns"`
+	Unique  bool           `json:"unique,omitempty"`
+}
+
+// UniqueError tells that a row would hold the same values of unique columns
+// as the row Row.
+type UniqueError struct {
+	Columns []string
+	Row     RowIdType
+}
+
+func (e *UniqueError) Error() string {
+	return fmt.Sprintf("%s: %s", ResponseStrings["U1"], strings.Join(e.Columns, ", "))
+}
+
+func newUniqueError(index TableIndex, columns []TableColumn, rid RowIdType) *UniqueError {
+	names := make([]string, len(index.Columns))
+	for i, id := range index.Columns {
+		names[i] = columns[id].Name
+	}
+	return &UniqueError{Columns: names, Row: rid}
+}
+
+func (index TableIndex) equal(other TableIndex) bool {
+	if index.Kind != other.Kind || len(index.Columns) != len(other.Columns) {
+		return false
+	}
+	for i, col := range index.Columns {
+		if other.Columns[i] != col {
+			return false
+		}
+	}
+	return true
+}
+
+// rowIndex is the data of a TableIndex, it is updated with every change of
+// the rows.
+type rowIndex interface {
+	add(row Row[ColumnIdType])
+	remove(row Row[ColumnIdType])
+	// conflict finds another row with the values of the row when the index
+	// is unique.
+	conflict(row Row[ColumnIdType]) (RowIdType, bool)
+}
+
+// hashIndex maps the values of a column to the ids of the rows holding them,
+// rows without a value are kept under nil.
+type hashIndex struct {
+	column ColumnIdType
+	unique bool
+	values map[any]map[RowIdType]struct{}
+}
+
+func (idx *hashIndex) add(row Row[ColumnIdType]) {
+	val := row.Columns[idx.column]
+	ids, ok := idx.values[val]
+	if !ok {
+		ids = make(map[RowIdType]struct{})
+		idx.values[val] = ids
+	}
+	ids[row.Id] = struct{}{}
+}
+
+func (idx *hashIndex) remove(row Row[ColumnIdType]) {
+	val := row.Columns[idx.column]
+	ids := idx.values[val]
+	delete(ids, row.Id)
+	if len(ids) == 0 {
+		delete(idx.values, val)
+	}
+}
+
+func (idx *hashIndex) conflict(row Row[ColumnIdType]) (RowIdType, bool) {
+	val := row.Columns[idx.column]
+	if !idx.unique || val == nil {
+		return 0, false
+	}
+	for rid := range idx.values[val] {
+		if rid != row.Id {
+			return rid, true
+		}
+	}
+	return 0, false
+}
+
+// lookup finds a row holding the value.
+func (idx *hashIndex) lookup(val any) (RowIdType, bool) {
+	for rid := range idx.values[val] {
+		return rid, true
+	}
+	return 0, false
+}
+
+func (db *DB) CreateIndex(tid TableIdType, index TableIndex) error {
+	return db.changeIndex(LogNewIndex, tid, index)
+}
+
+func (db *DB) DropIndex(tid TableIdType, index TableIndex) error {
+	return db.changeIndex(LogDropIndex, tid, index)
+}
+
+func (db *DB) changeIndex(op LogOperation, tid TableIdType, index TableIndex) error {
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	if !db.tableExists(tid) {
+		return fmt.Errorf(ResponseStrings["T1"])
+	}
+	return db.commitRecord(&LogRecord{
+		Op:     op,
+		Table:  tid,
+		Type:   index.Kind,
+		Keys:   index.Columns,
+		Unique: index.Unique,
+	})
+}
+
+// applyIndexRecord creates or drops an index, the caller holds catalogLock
+// exclusively.
+func (db *DB) applyIndexRecord(rec *LogRecord) (func(), error) {
+	table := &db.Store.Tables[rec.Table]
+	meta := &db.Store.TablesMetaData[rec.Table]
+	index := TableIndex{Kind: rec.Type, Columns: rec.Keys, Unique: rec.Unique}
+
+	pos := -1
+	for i, other := range meta.Indexes {
+		if other.equal(index) {
+			pos = i
+		}
+	}
+
+	definitions, data := meta.Indexes, table.indexes
+	if rec.Op == LogDropIndex {
+		if pos < 0 {
+			return nil, ErrIndexNotFound
+		}
+		if old := definitions[pos]; old.Kind == HashIndex && meta.Columns[old.Columns[0]].IsUnique {
+			return nil, fmt.Errorf("%w: column %s is unique", ErrWrongIndex, meta.Columns[old.Columns[0]].Name)
+		}
+		meta.Indexes = append(append([]TableIndex{}, definitions[:pos]...), definitions[pos+1:]...)
+		table.indexes = append(append([]rowIndex{}, data[:pos]...), data[pos+1:]...)
+	} else {
+		if pos >= 0 {
+			return nil, ErrIndexExists
+		}
+		if err := checkIndex(index, meta.Columns); err != nil {
+			return nil, err
+		}
+		idx, conflict := table.buildIndex(index)
+		if conflict != nil {
+			return nil, newUniqueError(index, meta.Columns, *conflict)
+		}
+		meta.Indexes = append(definitions[:len(definitions):len(definitions)], index)
+		table.indexes = append(data[:len(data):len(data)], idx)
+	}
+	return func() {
+		meta.Indexes, table.indexes = definitions, data
+	}, nil
+}
+
+func checkIndex(index TableIndex, columns []TableColumn) error {
+	if int(index.Kind) >= len(IndexKindsEnum) {
+		return fmt.Errorf("%w: %s", ErrWrongIndex, ResponseStrings["I3"])
+	}
+	if len(index.Columns) == 0 {
+		return fmt.Errorf("%w: it needs a column", ErrWrongIndex)
+	}
+	if index.Kind == HashIndex && len(index.Columns) > 1 {
+		return fmt.Errorf("%w: a hash index is on a single column", ErrWrongIndex)
+	}
+	seen := make(map[ColumnIdType]bool, len(index.Columns))
+	for _, id := range index.Columns {
+		if int(id) >= len(columns) {
+			return fmt.Errorf("%w: %s", ErrWrongIndex, ResponseStrings["C2"])
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: column %s is in it twice", ErrWrongIndex, columns[id].Name)
+		}
+		seen[id] = true
+		if typ := columns[id].Type; index.Kind == OrderedIndex && typ != NumberColumn && typ != StringColumn {
+			return fmt.Errorf("%w: an ordered index is on number and string columns", ErrWrongIndex)
+		}
+	}
+	return nil
+}
+
+// buildIndexes rebuilds the indexes of a table whose Rows were set as a whole.
+func (t *Table) buildIndexes(indexes []TableIndex) {
+	t.indexes = make([]rowIndex, len(indexes))
+	for i, index := range indexes {
+		t.indexes[i], _ = t.buildIndex(index)
+	}
+}
+
+// buildIndex indexes the rows of the table, for a unique index it also
+// returns the id of the first row holding the values of an earlier one.
+func (t *Table) buildIndex(index TableIndex) (rowIndex, *RowIdType) {
+	var idx rowIndex
+	if index.Kind == OrderedIndex {
+		idx = newOrderedIndex(index.Columns, index.Unique)
+	} else {
+		idx = &hashIndex{column: index.Columns[0], unique: index.Unique, values: map[any]map[RowIdType]struct{}{}}
+	}
+	var conflict *RowIdType
+	for _, row := range t.Rows {
+		if row.Deleted {
+			continue
+		}
+		if _, ok := idx.conflict(row); ok && conflict == nil {
+			rid := row.Id
+			conflict = &rid
+		}
+		idx.add(row)
+	}
+	return idx, conflict
+}
+
+// indexRow adds the values of the row to the indexes of the table.
+func (t *Table) indexRow(row Row[ColumnIdType]) {
+	for _, idx := range t.indexes {
+		idx.add(row)
+	}
+}
+
+// unindexRow removes the values of the row from the indexes of the table.
+func (t *Table) unindexRow(row Row[ColumnIdType]) {
+	for _, idx := range t.indexes {
+		idx.remove(row)
+	}
+}
+
+// checkUnique fails when a unique index of the table holds the values of
+// the row for another row.
+func (t *Table) checkUnique(row Row[ColumnIdType], meta *TableMetaData) error {
+	for i, idx := range t.indexes {
+		if rid, ok := idx.conflict(row); ok {
+			return newUniqueError(meta.Indexes[i], meta.Columns, rid)
+		}
+	}
+	return nil
+}
+
+// keyIndex returns the unique hash index on the column, which every unique
+// column has.
+func (t *Table) keyIndex(meta *TableMetaData, column ColumnIdType) (*hashIndex, error) {
+	for i, index := range meta.Indexes {
+		if idx, ok := t.indexes[i].(*hashIndex); ok && index.Unique && idx.column == column {
+			return idx, nil
+		}
+	}
+	return nil, ErrUpsertKey
+}
+
+// IndexOrder tells in what order the rows found with an index are returned.
+type IndexOrder uint8
+
+const (
+	TableOrder      IndexOrder = iota // the order of Rows
+	KeyOrder                          // by the key of an ordered index, then by id
+	ReverseKeyOrder                   // by the key descending, then by id
+)
+
+// IndexedRows uses the hash index at this position of
+// TableMetaData.Indexes to find the rows which hold one of the values, or,
+// with exclude, the rows which hold none of them. Rows without a value for
+// the column are always returned, as filters let them through. It returns
+// false when the index is not a hash index.
+func (t *Table) IndexedRows(index int, values []any, exclude bool) ([]Row[ColumnIdType], bool) {
+	idx, ok := t.indexAt(index).(*hashIndex)
+	if !ok {
+		return nil, false
+	}
+
+	var positions []int
+	if exclude {
+		skip := make(map[RowIdType]bool)
+		for _, val := range values {
+			for rid := range idx.values[val] {
+				skip[rid] = true
+			}
+		}
+		for pos, row := range t.Rows {
+			if !row.Deleted && !skip[row.Id] {
+				positions = append(positions, pos)
+			}
+		}
+	} else {
+		seen := make(map[any]bool, len(values)+1)
+		for _, val := range append([]any{nil}, values...) {
+			if seen[val] {
+				continue
+			}
+			seen[val] = true
+			for rid := range idx.values[val] {
+				positions = append(positions, t.index[rid])
+			}
+		}
+		sort.Ints(positions)
+	}
+	return t.rowsAt(positions), true
+}
+
+// RangeRows uses the ordered index at this position of
+// TableMetaData.Indexes to find the rows within the range. It returns false
+// when the index is not an ordered one.
+func (t *Table) RangeRows(index int, r KeyRange, order IndexOrder) ([]Row[ColumnIdType], bool) {
+	idx, ok := t.indexAt(index).(*orderedIndex)
+	if !ok || r.depth() > len(idx.columns) {
+		return nil, false
+	}
+
+	var entries []orderedEntry
+	idx.scan(r, func(e orderedEntry) {
+		entries = append(entries, e)
+	})
+
+	switch order {
+	case KeyOrder:
+	case ReverseKeyOrder:
+		entries = reverseKeyOrder(entries)
+	default:
+		positions := make([]int, len(entries))
+		for i, e := range entries {
+			positions[i] = t.index[e.id]
+		}
+		sort.Ints(positions)
+		return t.rowsAt(positions), true
+	}
+
+	rows := make([]Row[ColumnIdType], len(entries))
+	for i, e := range entries {
+		rows[i] = t.Rows[t.index[e.id]]
+	}
+	return rows, true
+}
+
+func (t *Table) indexAt(index int) rowIndex {
+	if index < 0 || index >= len(t.indexes) {
+		return nil
+	}
+	return t.indexes[index]
+}
+
+func (t *Table) rowsAt(positions []int) []Row[ColumnIdType] {
+	rows := make([]Row[ColumnIdType], len(positions))
+	for i, pos := range positions {
+		rows[i] = t.Rows[pos]
+	}
+	return rows
+}
+
+// reverseKeyOrder turns entries sorted by key then id into entries sorted by
+// key descending, rows with the same key stay sorted by id.
+func reverseKeyOrder(entries []orderedEntry) []orderedEntry {
+	reversed := make([]orderedEntry, 0, len(entries))
+	for end := len(entries); end > 0; {
+		start := end - 1
+		for start > 0 && compareKeys(entries[start-1].key, entries[end-1].key) == 0 {
+			start--
+		}
+		reversed = append(reversed, entries[start:end]...)
+		end = start
+	}
+	return reversed
+}
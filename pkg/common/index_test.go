@@ -0,0 +1,220 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+var nameIndex = TableIndex{Kind: HashIndex, Columns: []ColumnIdType{0}}
+
+func indexedIds(t *testing.T, val any, exclude bool) []RowIdType {
+	var ids []RowIdType
+	err := Default.ReadTable(0, func(table *Table, _ *TableMetaData) error {
+		rows, ok := table.IndexedRows(0, []any{val}, exclude)
+		if !ok {
+			t.Fatal("expected the column to be indexed")
+		}
+		for _, row := range rows {
+			ids = append(ids, row.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestIndexMaintained(t *testing.T) {
+	configRows(t, "a", "b", "a")
+	if err := Default.CreateIndex(0, nameIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.CreateIndex(0, nameIndex); !errors.Is(err, ErrIndexExists) {
+		t.Fatalf("expected a second index to be refused, but returned %v", err)
+	}
+
+	if ids := indexedIds(t, "a", false); len(ids) != 2 || ids[0] != 0 || ids[1] != 2 {
+		t.Fatalf("expected rows 0 and 2, but returned %v", ids)
+	}
+
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.UpdateRow(0, 0, map[ColumnIdType]interface{}{0: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.DeleteRow(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if ids := indexedIds(t, "a", false); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("expected row 3, but returned %v", ids)
+	}
+	if ids := indexedIds(t, "b", true); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("expected row 3, but returned %v", ids)
+	}
+
+	// a failed batch leaves the index as it was
+	if _, err := Default.UpdateRows(0, []RowIdType{1, 9}, map[ColumnIdType]interface{}{0: "a"}); err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	if ids := indexedIds(t, "a", false); len(ids) != 1 {
+		t.Fatalf("expected row 3, but returned %v", ids)
+	}
+
+	if err := Default.DropIndex(0, nameIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.DropIndex(0, nameIndex); !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("expected a missing index not to be dropped, but returned %v", err)
+	}
+}
+
+func TestIndexRebuiltOnConfig(t *testing.T) {
+	configRows(t, "a", "b")
+	if err := Default.CreateIndex(0, nameIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	store := DatabaseStore{
+		Tables:         []Table{{Rows: Default.Store.Tables[0].Rows}},
+		TablesMetaData: Default.ListTables(),
+	}
+	Default.Config(store)
+	if ids := indexedIds(t, "b", false); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("expected row 1, but returned %v", ids)
+	}
+}
+
+func TestIndexReplay(t *testing.T) {
+	configRows(t, "a")
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	Default.Journal = wal
+	defer func() { Default.Journal = nil }()
+
+	if err := Default.CreateIndex(0, nameIndex); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+	Default.Journal = nil
+
+	configRows(t, "a")
+	for _, rec := range replayAll(t, openTestLog(t, dir), 0) {
+		if err := Default.ApplyLogRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := indexedIds(t, "a", false); len(ids) != 1 || ids[0] != 0 {
+		t.Fatalf("expected row 0, but returned %v", ids)
+	}
+}
+
+func TestUniqueColumn(t *testing.T) {
+	configRows(t, "a", "b")
+	email, err := Default.AddColumn(0, TableColumn{Name: "email", Type: StringColumn, IsOptional: true, IsUnique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.UpdateRow(0, 0, map[ColumnIdType]interface{}{email: "a@x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var uerr *UniqueError
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "c", email: "a@x"}); !errors.As(err, &uerr) || uerr.Row != 0 {
+		t.Fatalf("expected a conflict with row 0, but returned %v", err)
+	}
+	// rows without a value don't conflict
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	// a row keeps its own value
+	if err := Default.UpdateRow(0, 0, map[ColumnIdType]interface{}{0: "aa", email: "a@x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a batch giving two rows the same value changes none of them
+	if _, err := Default.UpdateRows(0, []RowIdType{1, 2}, map[ColumnIdType]interface{}{email: "b@x"}); !errors.As(err, &uerr) {
+		t.Fatalf("expected a conflict, but returned %v", err)
+	}
+	for _, rid := range []RowIdType{1, 2} {
+		if row, _ := Default.GetRowById(0, rid); row.Columns[email] != nil {
+			t.Fatalf("expected row %d to stay without an email, but returned %v", rid, row.Columns[email])
+		}
+	}
+	if err := Default.UpdateRow(0, 1, map[ColumnIdType]interface{}{email: "b@x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Default.DropIndex(0, TableIndex{Kind: HashIndex, Columns: []ColumnIdType{email}}); !errors.Is(err, ErrWrongIndex) {
+		t.Fatalf("expected the index of a unique column to stay, but returned %v", err)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	configRows(t, "a", "b", "a")
+	pair := TableIndex{Kind: OrderedIndex, Columns: []ColumnIdType{0}, Unique: true}
+	var uerr *UniqueError
+	if err := Default.CreateIndex(0, pair); !errors.As(err, &uerr) || uerr.Row != 2 {
+		t.Fatalf("expected the duplicate row 2 to be found, but returned %v", err)
+	}
+	if n := len(Default.ListTables()[0].Indexes); n != 0 {
+		t.Fatalf("expected no index, but returned %d", n)
+	}
+
+	if err := Default.DeleteRow(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	age, err := Default.CreateNewColumn(0, "age", NumberColumn, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair.Columns = []ColumnIdType{0, age}
+	if err := Default.CreateIndex(0, pair); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "a", age: 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "a", age: 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "a", age: 1.0}); !errors.As(err, &uerr) || uerr.Row != 3 {
+		t.Fatalf("expected a conflict with row 3, but returned %v", err)
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	configRows(t)
+	if _, err := Default.AddColumn(0, TableColumn{Name: "login", Type: StringColumn, IsOptional: true, IsPrimary: true}); err == nil {
+		t.Fatal("expected an optional primary key to be refused")
+	}
+	login, err := Default.AddColumn(0, TableColumn{Name: "login", Type: StringColumn, IsPrimary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.AddColumn(0, TableColumn{Name: "code", Type: NumberColumn, IsPrimary: true}); err == nil {
+		t.Fatal("expected a second primary key to be refused")
+	}
+
+	pk, err := Default.PrimaryKey(0)
+	if err != nil || pk.Id != login || !pk.IsUnique {
+		t.Fatalf("expected the unique column login, but returned %+v, %v", pk, err)
+	}
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "a", login: "al"}); err != nil {
+		t.Fatal(err)
+	}
+	var uerr *UniqueError
+	if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "b", login: "al"}); !errors.As(err, &uerr) {
+		t.Fatalf("expected a conflict, but returned %v", err)
+	}
+
+	configRows(t, "a")
+	if _, err := Default.AddColumn(0, TableColumn{Name: "login", Type: StringColumn, IsPrimary: true}); err == nil {
+		t.Fatal("expected a primary key to be refused on a table with rows")
+	}
+	if _, err := Default.PrimaryKey(0); err == nil {
+		t.Fatal("expected no primary key")
+	}
+}
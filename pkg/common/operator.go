@@ -1,7 +1,9 @@
 package common
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 )
 
 var ColumnsTypeEnum = [3]string{
@@ -10,21 +12,78 @@ var ColumnsTypeEnum = [3]string{
 	"bool",
 }
 
-var Store DatabaseStore
+// column types, indexes of ColumnsTypeEnum
+const (
+	NumberColumn uint8 = iota
+	StringColumn
+	BoolColumn
+)
 
-func GetRowById(tid TableIdType, id RowIdType) (Row[ColumnIdType], error) {
-	if tid >= TableIdType(len(Store.Tables)) {
-		return Row[ColumnIdType]{}, fmt.Errorf(ResponseStrings["T1"])
+func ColumnTypeByName(name string) (uint8, error) {
+	for idx, typ := range ColumnsTypeEnum {
+		if typ == name {
+			return uint8(idx), nil
+		}
 	}
-	if id >= RowIdType(len(Store.Tables[tid].Rows)) {
-		return Row[ColumnIdType]{}, fmt.Errorf(ResponseStrings["R1"])
+	return 0, fmt.Errorf(ResponseStrings["C1"])
+}
+
+// ReadTable runs fn while no one can modify the table. Neither the table nor
+// its rows' column maps may be retained or modified after fn returns.
+func (db *DB) ReadTable(tid TableIdType, fn func(table *Table, meta *TableMetaData) error) error {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+
+	if !db.tableExists(tid) {
+		return fmt.Errorf(ResponseStrings["T1"])
+	}
+	table := &db.Store.Tables[tid]
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	return fn(table, &db.Store.TablesMetaData[tid])
+}
+
+// writeTable runs fn with the table locked exclusively.
+func (db *DB) writeTable(tid TableIdType, fn func(table *Table) error) error {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+
+	if !db.tableExists(tid) {
+		return fmt.Errorf(ResponseStrings["T1"])
 	}
+	table := &db.Store.Tables[tid]
+	table.lock.Lock()
+	defer table.lock.Unlock()
 
-	return Store.Tables[tid].Rows[id], nil
+	return fn(table)
 }
 
-func FindColumnByName(tid TableIdType, name string) (ColumnIdType, error) {
-	for idx, col := range Store.TablesMetaData[tid].Columns {
+func (db *DB) GetRowById(tid TableIdType, id RowIdType) (Row[ColumnIdType], error) {
+	var row Row[ColumnIdType]
+	err := db.ReadTable(tid, func(table *Table, _ *TableMetaData) error {
+		pos, ok := table.rowPosition(id)
+		if !ok {
+			return fmt.Errorf(ResponseStrings["R1"])
+		}
+		row = table.Rows[pos].clone()
+		return nil
+	})
+	return row, err
+}
+
+func (db *DB) FindColumnByName(tid TableIdType, name string) (ColumnIdType, error) {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+
+	if !db.tableExists(tid) {
+		return 0, fmt.Errorf(ResponseStrings["T1"])
+	}
+	return findColumn(db.Store.TablesMetaData[tid].Columns, name)
+}
+
+func findColumn(columns []TableColumn, name string) (ColumnIdType, error) {
+	for idx, col := range columns {
 		if col.Name == name {
 			return ColumnIdType(idx), nil
 		}
@@ -32,65 +91,526 @@ func FindColumnByName(tid TableIdType, name string) (ColumnIdType, error) {
 	return 0, fmt.Errorf(ResponseStrings["C2"])
 }
 
-func AddNewRow(tid TableIdType, cols map[ColumnIdType]interface{}) (RowIdType, error) {
-	var newRow Row[ColumnIdType]
-	newRow.Id = RowIdType(len(Store.Tables[tid].Rows))
-	newRow.Columns = make(map[ColumnIdType]interface{})
-
-	// checking for type & assigning values to the row
-	for cid, val := range cols {
-		switch Store.TablesMetaData[tid].Columns[cid].Type {
-		case 0:
-			switch val.(type) {
-			case int:
-				newRow.Columns[cid] = float64(val.(int))
-			case float64:
-				newRow.Columns[cid] = val.(float64)
+// PrimaryKey returns the primary key column of the table.
+func (db *DB) PrimaryKey(tid TableIdType) (TableColumn, error) {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+
+	if !db.tableExists(tid) {
+		return TableColumn{}, fmt.Errorf(ResponseStrings["T1"])
+	}
+	return PrimaryKeyOf(db.Store.TablesMetaData[tid].Columns)
+}
+
+func PrimaryKeyOf(columns []TableColumn) (TableColumn, error) {
+	for _, col := range columns {
+		if col.IsPrimary {
+			return col, nil
+		}
+	}
+	return TableColumn{}, fmt.Errorf(ResponseStrings["P1"])
+}
+
+func (db *DB) AddNewRow(tid TableIdType, cols map[ColumnIdType]interface{}) (RowIdType, error) {
+	rec := LogRecord{
+		Op:      LogInsertRow,
+		Table:   tid,
+		Columns: cols,
+	}
+	err := db.writeTable(tid, func(table *Table) error {
+		rec.Row = table.NextRowId
+		return db.commitRecord(&rec)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rec.Row, nil
+}
+
+// InsertRows inserts a batch of rows with a single record of the log. A row
+// that can't be inserted gets its error at its position in errs and the
+// others are inserted, unless atomic is set: then none is and ids is nil.
+// err tells that the whole batch failed.
+func (db *DB) InsertRows(tid TableIdType, rows []map[ColumnIdType]interface{}, atomic bool) (ids []RowIdType, errs []error, err error) {
+	ids = make([]RowIdType, len(rows))
+	errs = make([]error, len(rows))
+	err = db.writeTable(tid, func(table *Table) error {
+		batch := make([]LogRecord, 0, len(rows))
+		undos := make([]func(), 0, len(rows))
+		undoAll := func() {
+			for i := len(undos) - 1; i >= 0; i-- {
+				undos[i]()
+			}
+		}
+
+		for i, cols := range rows {
+			rec := LogRecord{Op: LogInsertRow, Table: tid, Row: table.NextRowId, Columns: cols}
+			undo, err := db.applyRecord(&rec)
+			if err != nil {
+				errs[i] = err
+				if atomic {
+					undoAll()
+					ids = nil
+					return nil
+				}
+				continue
 			}
-		case 1:
-			newRow.Columns[cid] = val.(string)
-		case 2:
-			newRow.Columns[cid] = val.(bool)
+			undos = append(undos, undo)
+			batch = append(batch, rec)
+			ids[i] = rec.Row
+		}
+
+		if len(batch) == 0 {
+			return nil
 		}
+		if err := db.writeLog(LogRecord{Op: LogCommit, Batch: batch}); err != nil {
+			undoAll()
+			return err
+		}
+		return nil
+	})
+	return ids, errs, err
+}
+
+// reserveRowId hands out an id for a row that will be inserted later, e.g.
+// when a transaction commits.
+func (db *DB) reserveRowId(tid TableIdType) (RowIdType, error) {
+	var rid RowIdType
+	err := db.writeTable(tid, func(table *Table) error {
+		rid = table.NextRowId
+		table.NextRowId++
+		return nil
+	})
+	return rid, err
+}
+
+func (db *DB) CreateNewColumn(tid TableIdType, name string, colType uint8, optional bool) (ColumnIdType, error) {
+	return db.AddColumn(tid, TableColumn{Name: name, Type: colType, IsOptional: optional})
+}
+
+// AddColumn creates a column with the name, type and flags of col, its id
+// is assigned. A unique column gets a unique index, a primary key can only
+// be added to a table without rows.
+func (db *DB) AddColumn(tid TableIdType, col TableColumn) (ColumnIdType, error) {
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	if !db.tableExists(tid) {
+		return 0, fmt.Errorf(ResponseStrings["T1"])
 	}
 
-	Store.Tables[tid].Rows = append(Store.Tables[tid].Rows, newRow)
+	rec := LogRecord{
+		Op:       LogNewColumn,
+		Table:    tid,
+		Column:   ColumnIdType(len(db.Store.TablesMetaData[tid].Columns)),
+		Name:     col.Name,
+		Type:     col.Type,
+		Optional: col.IsOptional,
+		Unique:   col.IsUnique,
+		Primary:  col.IsPrimary,
+	}
+	if err := db.commitRecord(&rec); err != nil {
+		return 0, err
+	}
+
+	return rec.Column, nil
+}
+
+func (db *DB) UpdateRow(tid TableIdType, rid RowIdType, diff map[ColumnIdType]interface{}) error {
+	return db.writeTable(tid, func(table *Table) error {
+		return db.commitRecord(&LogRecord{
+			Op:      LogUpdateRow,
+			Table:   tid,
+			Row:     rid,
+			Columns: diff,
+		})
+	})
+}
+
+// UpdateRows changes all the rows or none of them. If some rows don't exist
+// their ids are returned and nothing is modified. Nothing is logged for an
+// empty list.
+func (db *DB) UpdateRows(tid TableIdType, rids []RowIdType, diff map[ColumnIdType]interface{}) ([]RowIdType, error) {
+	err := db.writeTable(tid, func(table *Table) error {
+		if len(rids) == 0 {
+			return nil
+		}
+		return db.commitRecord(&LogRecord{
+			Op:      LogUpdateRows,
+			Table:   tid,
+			Rows:    rids,
+			Columns: diff,
+		})
+	})
+	return failedRows(err), err
+}
+
+// UpdateMatching updates the rows find selects the same way as UpdateRows
+// and returns their ids. find runs with the table locked for writing, so
+// no row changes between being matched and being updated.
+func (db *DB) UpdateMatching(tid TableIdType, find func(table *Table, meta *TableMetaData) ([]RowIdType, error), diff map[ColumnIdType]interface{}) ([]RowIdType, []RowIdType, error) {
+	var rids []RowIdType
+	err := db.writeTable(tid, func(table *Table) error {
+		var err error
+		if rids, err = find(table, &db.Store.TablesMetaData[tid]); err != nil || len(rids) == 0 {
+			return err
+		}
+		return db.commitRecord(&LogRecord{
+			Op:      LogUpdateRows,
+			Table:   tid,
+			Rows:    rids,
+			Columns: diff,
+		})
+	})
+	return rids, failedRows(err), err
+}
 
-	return newRow.Id, nil
+func (db *DB) DeleteRow(tid TableIdType, rid RowIdType) error {
+	return db.writeTable(tid, func(table *Table) error {
+		if err := db.commitRecord(&LogRecord{
+			Op:    LogDeleteRow,
+			Table: tid,
+			Row:   rid,
+		}); err != nil {
+			return err
+		}
+		table.compact()
+		return nil
+	})
 }
 
-func (table *TableMetaData) CreateNewColumn(name string, colType uint8) (ColumnIdType, error) {
-	columns := table.Columns
-	newColumn := TableColumn{
-		Id:         ColumnIdType(len(columns)),
-		Name:       name,
-		Type:       colType,
-		IsOptional: false,
+// DeleteRows removes all the rows or none of them. If some rows don't exist
+// their ids are returned and nothing is deleted.
+func (db *DB) DeleteRows(tid TableIdType, rids []RowIdType) ([]RowIdType, error) {
+	err := db.writeTable(tid, func(table *Table) error {
+		if len(rids) == 0 {
+			return nil
+		}
+		if err := db.commitRecord(&LogRecord{
+			Op:    LogDeleteRows,
+			Table: tid,
+			Rows:  rids,
+		}); err != nil {
+			return err
+		}
+		table.compact()
+		return nil
+	})
+	return failedRows(err), err
+}
+
+// DeleteMatching removes the rows find selects the same way as DeleteRows
+// and returns their ids, find runs with the table locked for writing.
+func (db *DB) DeleteMatching(tid TableIdType, find func(table *Table, meta *TableMetaData) ([]RowIdType, error)) ([]RowIdType, []RowIdType, error) {
+	var rids []RowIdType
+	err := db.writeTable(tid, func(table *Table) error {
+		var err error
+		if rids, err = find(table, &db.Store.TablesMetaData[tid]); err != nil || len(rids) == 0 {
+			return err
+		}
+		if err := db.commitRecord(&LogRecord{
+			Op:    LogDeleteRows,
+			Table: tid,
+			Rows:  rids,
+		}); err != nil {
+			return err
+		}
+		table.compact()
+		return nil
+	})
+	return rids, failedRows(err), err
+}
+
+// RowsNotFoundError aborts a batch that refers to missing or repeated rows.
+type RowsNotFoundError struct {
+	Rows []RowIdType
+}
+
+func (e *RowsNotFoundError) Error() string {
+	return ResponseStrings["R1"]
+}
+
+func failedRows(err error) []RowIdType {
+	var notFound *RowsNotFoundError
+	if errors.As(err, &notFound) {
+		return notFound.Rows
 	}
-	(*table).Columns = append(columns, newColumn)
+	return nil
+}
 
-	return newColumn.Id, nil
+// commitRecord applies a mutation and makes it durable, it is undone when
+// the log can't be written. The caller holds the locks the mutation needs.
+func (db *DB) commitRecord(rec *LogRecord) error {
+	undo, err := db.applyRecord(rec)
+	if err != nil {
+		return err
+	}
+	if err := db.writeLog(*rec); err != nil {
+		undo()
+		return err
+	}
+	return nil
 }
 
-func (t Table) UpdateRow(rid RowIdType, diff map[ColumnIdType]interface{}) error {
-	if rid >= RowIdType(len(t.Rows)) {
-		return fmt.Errorf(ResponseStrings["R1"])
+// applyRecord validates and applies a row, column or index mutation without logging
+// it, the record's values are replaced with the stored representation. The
+// returned function reverts the change as long as nothing else modified the
+// table since. Deleted rows are not compacted so the undo stays possible.
+func (db *DB) applyRecord(rec *LogRecord) (func(), error) {
+	if !db.tableExists(rec.Table) {
+		return nil, fmt.Errorf(ResponseStrings["T1"])
 	}
+	table := &db.Store.Tables[rec.Table]
+	meta := &db.Store.TablesMetaData[rec.Table]
 
-	// TODO: add data type checking
-	for id, val := range diff {
-		t.Rows[rid].Columns[id] = val
+	switch rec.Op {
+	case LogInsertRow:
+		if _, ok := table.rowPosition(rec.Row); ok {
+			return nil, fmt.Errorf("row with id %d already exists", rec.Row)
+		}
+		values, err := validateRow(meta.Columns, rec.Columns)
+		if err != nil {
+			return nil, err
+		}
+		rec.Columns = values
+
+		nextRowId := table.NextRowId
+		row := Row[ColumnIdType]{Id: rec.Row, Columns: values}
+		if err := table.checkUnique(row, meta); err != nil {
+			return nil, err
+		}
+		table.index[rec.Row] = len(table.Rows)
+		table.Rows = append(table.Rows, row)
+		table.indexRow(row)
+		if rec.Row >= table.NextRowId {
+			table.NextRowId = rec.Row + 1
+		}
+		return func() {
+			table.unindexRow(row)
+			delete(table.index, rec.Row)
+			table.Rows = table.Rows[:len(table.Rows)-1]
+			table.NextRowId = nextRowId
+		}, nil
+
+	case LogUpdateRow, LogUpdateRows:
+		rids := rec.Rows
+		if rec.Op == LogUpdateRow {
+			rids = []RowIdType{rec.Row}
+		}
+		positions, failed := table.rowPositions(rids)
+		if len(failed) > 0 {
+			return nil, &RowsNotFoundError{failed}
+		}
+		diff, err := validateDiff(meta.Columns, rec.Columns)
+		if err != nil {
+			return nil, err
+		}
+		rec.Columns = diff
+
+		previous := make([]Row[ColumnIdType], 0, len(positions))
+		undo := func() {
+			for i, row := range previous {
+				table.unindexRow(table.Rows[positions[i]])
+				table.Rows[positions[i]] = row
+				table.indexRow(row)
+			}
+		}
+		for _, pos := range positions {
+			// a row is checked against the rows updated before it
+			row := table.Rows[pos].clone()
+			table.unindexRow(row)
+			table.applyDiff(pos, diff)
+			previous = append(previous, row)
+			err := table.checkUnique(table.Rows[pos], meta)
+			table.indexRow(table.Rows[pos])
+			if err != nil {
+				undo()
+				return nil, err
+			}
+		}
+		return undo, nil
+
+	case LogDeleteRow, LogDeleteRows:
+		rids := rec.Rows
+		if rec.Op == LogDeleteRow {
+			rids = []RowIdType{rec.Row}
+		}
+		positions, failed := table.rowPositions(rids)
+		if len(failed) > 0 {
+			return nil, &RowsNotFoundError{failed}
+		}
+
+		previous := make([]Row[ColumnIdType], len(positions))
+		for i, pos := range positions {
+			previous[i] = table.Rows[pos]
+			table.removeRow(pos)
+		}
+		return func() {
+			for i, pos := range positions {
+				table.Rows[pos] = previous[i]
+				table.index[previous[i].Id] = pos
+				table.indexRow(previous[i])
+				table.deleted--
+			}
+		}, nil
+
+	case LogNewColumn:
+		columns := meta.Columns
+		if rec.Column != ColumnIdType(len(columns)) {
+			return nil, fmt.Errorf("column %s was created with id %d instead of %d", rec.Name, len(columns), rec.Column)
+		}
+		if _, err := findColumn(columns, rec.Name); err == nil {
+			return nil, fmt.Errorf(ResponseStrings["C3"])
+		}
+		if rec.Type >= uint8(len(ColumnsTypeEnum)) {
+			return nil, fmt.Errorf(ResponseStrings["C1"])
+		}
+
+		if rec.Primary {
+			if err := checkPrimaryKey(table, meta, rec.Optional); err != nil {
+				return nil, err
+			}
+		}
+
+		column := TableColumn{
+			Id:         rec.Column,
+			Name:       rec.Name,
+			Type:       rec.Type,
+			IsOptional: rec.Optional,
+			IsUnique:   rec.Unique || rec.Primary,
+			IsPrimary:  rec.Primary,
+		}
+		meta.Columns = append(columns, column)
+		if !column.IsUnique {
+			return func() {
+				meta.Columns = columns
+			}, nil
+		}
+
+		// the column has no values yet, its index can't find duplicates
+		indexes, data := meta.Indexes, table.indexes
+		index := TableIndex{Kind: HashIndex, Columns: []ColumnIdType{column.Id}, Unique: true}
+		idx, _ := table.buildIndex(index)
+		meta.Indexes = append(indexes[:len(indexes):len(indexes)], index)
+		table.indexes = append(data[:len(data):len(data)], idx)
+		return func() {
+			meta.Columns = columns
+			meta.Indexes, table.indexes = indexes, data
+		}, nil
+
+	case LogNewIndex, LogDropIndex:
+		return db.applyIndexRecord(rec)
 	}
 
+	return nil, fmt.Errorf("unknown log operation %d", rec.Op)
+}
+
+// checkPrimaryKey tells whether a table can get a primary key column.
+func checkPrimaryKey(table *Table, meta *TableMetaData, optional bool) error {
+	if optional {
+		return fmt.Errorf(ResponseStrings["P3"])
+	}
+	if _, err := PrimaryKeyOf(meta.Columns); err == nil {
+		return fmt.Errorf(ResponseStrings["P2"])
+	}
+	if len(table.index) > 0 {
+		return fmt.Errorf(ResponseStrings["P4"])
+	}
 	return nil
 }
 
-func (t *Table) DeleteRow(rid RowIdType) error {
-	if rid >= RowIdType(len(t.Rows)) {
-		return fmt.Errorf(ResponseStrings["R1"])
+func (row Row[T]) clone() Row[T] {
+	cols := make(map[T]interface{}, len(row.Columns))
+	for id, val := range row.Columns {
+		cols[id] = val
 	}
+	row.Columns = cols
+	return row
+}
 
-	t.Rows = append(t.Rows[:rid], t.Rows[rid+1:]...)
+func (t *Table) applyDiff(pos int, diff map[ColumnIdType]interface{}) {
+	if t.Rows[pos].Columns == nil {
+		t.Rows[pos].Columns = make(map[ColumnIdType]interface{})
+	}
+	for id, val := range diff {
+		if val == nil {
+			delete(t.Rows[pos].Columns, id)
+		} else {
+			t.Rows[pos].Columns[id] = val
+		}
+	}
+}
 
-	return nil
+func (t *Table) removeRow(pos int) {
+	// the slot is kept so positions of other rows stay valid
+	rid := t.Rows[pos].Id
+	t.unindexRow(t.Rows[pos])
+	t.Rows[pos] = Row[ColumnIdType]{Id: rid, Deleted: true}
+	delete(t.index, rid)
+	t.deleted++
+}
+
+// rowPositions looks up every row of a batch, ids that are missing or
+// repeated are returned as failed.
+func (t *Table) rowPositions(rids []RowIdType) ([]int, []RowIdType) {
+	var failed []RowIdType
+	positions := make([]int, 0, len(rids))
+	seen := make(map[RowIdType]bool, len(rids))
+	for _, rid := range rids {
+		pos, ok := t.rowPosition(rid)
+		if !ok || seen[rid] {
+			failed = append(failed, rid)
+			continue
+		}
+		seen[rid] = true
+		positions = append(positions, pos)
+	}
+	return positions, failed
+}
+
+// rowPosition finds where the row with this id is kept in Rows.
+func (t *Table) rowPosition(rid RowIdType) (int, bool) {
+	pos, ok := t.index[rid]
+	return pos, ok
+}
+
+// init prepares a table whose Rows were set as a whole (e.g. loaded from a
+// snapshot), it must be done before the table is shared.
+func (t *Table) init() {
+	if t.lock == nil {
+		t.lock = &sync.RWMutex{}
+	}
+	t.Reindex()
+}
+
+// Reindex rebuilds the row id lookup from Rows.
+func (t *Table) Reindex() {
+	t.index = make(map[RowIdType]int, len(t.Rows))
+	t.deleted = 0
+	for pos, row := range t.Rows {
+		if row.Deleted {
+			t.deleted++
+			continue
+		}
+		t.index[row.Id] = pos
+		if row.Id >= t.NextRowId {
+			t.NextRowId = row.Id + 1
+		}
+	}
+}
+
+// compact drops deleted rows once they take up most of the table.
+func (t *Table) compact() {
+	if t.deleted < 64 || t.deleted*2 < len(t.Rows) {
+		return
+	}
+	rows := make([]Row[ColumnIdType], 0, len(t.Rows)-t.deleted)
+	for _, row := range t.Rows {
+		if !row.Deleted {
+			rows = append(rows, row)
+		}
+	}
+	t.Rows = rows
+	t.Reindex()
 }
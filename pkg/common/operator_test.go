@@ -0,0 +1,180 @@
+package common
+
+import "testing"
+
+func configRows(t *testing.T, names ...string) {
+	Default.Config(DatabaseStore{
+		Tables: []Table{{}},
+		TablesMetaData: []TableMetaData{{Columns: []TableColumn{
+			{Id: 0, Name: "name", Type: 1},
+		}}},
+	})
+	for _, name := range names {
+		if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRowIdsSurviveDelete(t *testing.T) {
+	configRows(t, "a", "b", "c")
+
+	if err := Default.DeleteRow(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.GetRowById(0, 1); err == nil {
+		t.Fatal("expected deleted row not to be found")
+	}
+	if err := Default.DeleteRow(0, 1); err == nil {
+		t.Fatal("expected a second delete of the same row to fail")
+	}
+
+	if err := Default.UpdateRow(0, 2, map[ColumnIdType]interface{}{0: "z"}); err != nil {
+		t.Fatal(err)
+	}
+	row, err := Default.GetRowById(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Columns[0] != "z" {
+		t.Fatalf("expected row 2 to be updated, but returned %+v", row)
+	}
+
+	rid, _ := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "d"})
+	if rid != 3 {
+		t.Fatalf("expected a new id 3, but returned %d", rid)
+	}
+}
+
+func TestRowIdsAfterCompaction(t *testing.T) {
+	names := make([]string, 200)
+	for i := range names {
+		names[i] = "row"
+	}
+	configRows(t, names...)
+
+	for rid := RowIdType(0); rid < 150; rid++ {
+		if err := Default.DeleteRow(0, rid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(Default.Store.Tables[0].Rows) >= 200 {
+		t.Fatalf("expected deleted rows to be compacted, but %d are kept", len(Default.Store.Tables[0].Rows))
+	}
+	for rid := RowIdType(150); rid < 200; rid++ {
+		if row, err := Default.GetRowById(0, rid); err != nil || row.Id != rid {
+			t.Fatalf("expected row %d to be found, but returned %+v (%v)", rid, row, err)
+		}
+	}
+}
+
+func TestUpdateRowsAllOrNothing(t *testing.T) {
+	configRows(t, "a", "b", "c")
+	diff := map[ColumnIdType]interface{}{0: "z"}
+
+	failed, err := Default.UpdateRows(0, []RowIdType{0, 7, 2}, diff)
+	if err == nil || len(failed) != 1 || failed[0] != 7 {
+		t.Fatalf("expected row 7 to fail, but returned %v (%v)", failed, err)
+	}
+	for rid := RowIdType(0); rid < 3; rid++ {
+		if row, _ := Default.GetRowById(0, rid); row.Columns[0] == "z" {
+			t.Fatalf("expected row %d to stay unchanged", rid)
+		}
+	}
+
+	if _, err := Default.UpdateRows(0, []RowIdType{0, 2}, map[ColumnIdType]interface{}{0: 1.0}); err == nil {
+		t.Fatal("expected a wrong value type to abort the batch")
+	}
+
+	if _, err := Default.UpdateRows(0, []RowIdType{0, 2}, diff); err != nil {
+		t.Fatal(err)
+	}
+	for _, rid := range []RowIdType{0, 2} {
+		if row, _ := Default.GetRowById(0, rid); row.Columns[0] != "z" {
+			t.Fatalf("expected row %d to be updated, but returned %+v", rid, row)
+		}
+	}
+}
+
+func TestDeleteRowsAllOrNothing(t *testing.T) {
+	configRows(t, "a", "b", "c")
+
+	failed, _ := Default.DeleteRows(0, []RowIdType{1, 1})
+	if len(failed) != 1 || failed[0] != 1 {
+		t.Fatalf("expected the repeated row to fail, but returned %v", failed)
+	}
+	if _, err := Default.GetRowById(0, 1); err != nil {
+		t.Fatal("expected row 1 to be kept")
+	}
+
+	if _, err := Default.DeleteRows(0, []RowIdType{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.GetRowById(0, 2); err != nil {
+		t.Fatal("expected row 2 to be kept")
+	}
+	for _, rid := range []RowIdType{0, 1} {
+		if _, err := Default.GetRowById(0, rid); err == nil {
+			t.Fatalf("expected row %d to be deleted", rid)
+		}
+	}
+}
+
+func TestInsertRows(t *testing.T) {
+	configRows(t, "a")
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	Default.Journal = wal
+	defer func() { Default.Journal = nil }()
+
+	rows := []map[ColumnIdType]interface{}{{0: "b"}, {0: 1.0}, {0: "c"}}
+	ids, errs, err := Default.InsertRows(0, rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil || ids[0] != 1 || ids[2] != 2 {
+		t.Fatalf("expected rows 1 and 2 and an error for the number, but returned %v %v", ids, errs)
+	}
+
+	ids, errs, err = Default.InsertRows(0, rows, true)
+	if err != nil || ids != nil || errs[1] == nil {
+		t.Fatalf("expected no row to be inserted, but returned %v %v %v", ids, errs, err)
+	}
+	wal.Close()
+
+	if recs := replayAll(t, openTestLog(t, dir), 0); len(recs) != 1 || len(recs[0].Batch) != 2 {
+		t.Fatalf("expected a single record of two rows, but returned %+v", recs)
+	}
+	if n := len(Default.Store.Tables[0].Rows); n != 3 {
+		t.Fatalf("expected 3 rows, but returned %d", n)
+	}
+}
+
+func TestEmptyBatchNotLogged(t *testing.T) {
+	configRows(t, "a")
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	Default.Journal = wal
+	defer func() { Default.Journal = nil }()
+
+	if _, err := Default.UpdateRows(0, []RowIdType{}, map[ColumnIdType]interface{}{0: "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.DeleteRows(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	none := func(*Table, *TableMetaData) ([]RowIdType, error) { return nil, nil }
+	if _, _, err := Default.DeleteMatching(0, none); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.UpdateRows(5, nil, nil); err == nil {
+		t.Fatal("expected a missing table to be reported")
+	}
+	wal.Close()
+
+	if recs := replayAll(t, openTestLog(t, dir), 0); len(recs) != 0 {
+		t.Fatalf("expected no record, but returned %+v", recs)
+	}
+}
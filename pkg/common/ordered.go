@@ -0,0 +1,208 @@
+package common
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// levels of the skip list of an ordered index, enough for about 4^16 rows
+const SKIP_LIST_LEVELS = 16
+
+// KeyRange selects entries of an ordered index: the first columns of the
+// index equal Equal and, when Bounded, the next column is between Lower and
+// Upper, nil meaning unbounded, or starts with Lower when Prefix is set.
+// Entries missing one of these values are selected too, as filters let
+// rows without a value through.
+type KeyRange struct {
+	Equal     []any
+	Bounded   bool
+	Lower     any
+	Upper     any
+	LowerOpen bool // Lower itself is out of the range
+	UpperOpen bool
+	Prefix    bool
+}
+
+// depth is the number of columns of the index the range looks at.
+func (r KeyRange) depth() int {
+	if r.Bounded {
+		return len(r.Equal) + 1
+	}
+	return len(r.Equal)
+}
+
+type orderedEntry struct {
+	key []any
+	id  RowIdType
+}
+
+type skipNode struct {
+	orderedEntry
+	next []*skipNode
+}
+
+// orderedIndex keeps the rows sorted by the values of its columns, then by
+// id, in a skip list. Missing values are nil and come first.
+type orderedIndex struct {
+	columns []ColumnIdType
+	unique  bool
+	head    skipNode
+	level   int
+	rnd     *rand.Rand
+}
+
+func newOrderedIndex(columns []ColumnIdType, unique bool) *orderedIndex {
+	return &orderedIndex{
+		columns: columns,
+		unique:  unique,
+		head:    skipNode{next: make([]*skipNode, SKIP_LIST_LEVELS)},
+		level:   1,
+		rnd:     rand.New(rand.NewSource(1)),
+	}
+}
+
+func (idx *orderedIndex) entry(row Row[ColumnIdType]) orderedEntry {
+	key := make([]any, len(idx.columns))
+	for i, col := range idx.columns {
+		key[i] = row.Columns[col]
+	}
+	return orderedEntry{key, row.Id}
+}
+
+// compareKeys compares keys by as many values as the shorter one has.
+func compareKeys(a, b []any) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := CompareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareEntries(a, b orderedEntry) int {
+	if c := compareKeys(a.key, b.key); c != 0 {
+		return c
+	}
+	switch {
+	case a.id < b.id:
+		return -1
+	case a.id > b.id:
+		return 1
+	}
+	return 0
+}
+
+// predecessors finds the last node before e on every level.
+func (idx *orderedIndex) predecessors(e orderedEntry) [SKIP_LIST_LEVELS]*skipNode {
+	var prev [SKIP_LIST_LEVELS]*skipNode
+	x := &idx.head
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && compareEntries(x.next[i].orderedEntry, e) < 0 {
+			x = x.next[i]
+		}
+		prev[i] = x
+	}
+	return prev
+}
+
+func (idx *orderedIndex) add(row Row[ColumnIdType]) {
+	e := idx.entry(row)
+	prev := idx.predecessors(e)
+
+	level := 1
+	for level < SKIP_LIST_LEVELS && idx.rnd.Intn(4) == 0 {
+		level++
+	}
+	for ; idx.level < level; idx.level++ {
+		prev[idx.level] = &idx.head
+	}
+
+	node := &skipNode{orderedEntry: e, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = prev[i].next[i]
+		prev[i].next[i] = node
+	}
+}
+
+func (idx *orderedIndex) remove(row Row[ColumnIdType]) {
+	e := idx.entry(row)
+	prev := idx.predecessors(e)
+
+	node := prev[0].next[0]
+	if node == nil || compareEntries(node.orderedEntry, e) != 0 {
+		return
+	}
+	for i := 0; i < idx.level && prev[i].next[i] == node; i++ {
+		prev[i].next[i] = node.next[i]
+	}
+	for idx.level > 1 && idx.head.next[idx.level-1] == nil {
+		idx.level--
+	}
+}
+
+func (idx *orderedIndex) conflict(row Row[ColumnIdType]) (RowIdType, bool) {
+	if !idx.unique {
+		return 0, false
+	}
+	e := idx.entry(row)
+	for _, val := range e.key {
+		if val == nil {
+			return 0, false
+		}
+	}
+	for n := idx.seek(e.key); n != nil && compareKeys(n.key, e.key) == 0; n = n.next[0] {
+		if n.id != row.Id {
+			return n.id, true
+		}
+	}
+	return 0, false
+}
+
+// seek returns the first node whose key is not before the given start of a key.
+func (idx *orderedIndex) seek(start []any) *skipNode {
+	x := &idx.head
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && compareKeys(x.next[i].key, start) < 0 {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
+
+// scan calls fn with the entries within the range in the order of the index.
+func (idx *orderedIndex) scan(r KeyRange, fn func(orderedEntry)) {
+	// the entries missing one of the values come first: their key is some
+	// of the equal values followed by nil
+	for i := 0; i < r.depth(); i++ {
+		start := append(append([]any{}, r.Equal[:i]...), nil)
+		for n := idx.seek(start); n != nil && compareKeys(n.key, start) == 0; n = n.next[0] {
+			fn(n.orderedEntry)
+		}
+	}
+
+	start := r.Equal
+	if r.Bounded && r.Lower != nil {
+		start = append(append([]any{}, r.Equal...), r.Lower)
+	}
+	for n := idx.seek(start); n != nil && compareKeys(n.key, r.Equal) == 0; n = n.next[0] {
+		if !r.Bounded {
+			fn(n.orderedEntry)
+			continue
+		}
+
+		val := n.key[len(r.Equal)]
+		if val == nil || (r.LowerOpen && CompareValues(val, r.Lower) == 0) {
+			continue
+		}
+		if r.Prefix {
+			if s, ok := val.(string); !ok || !strings.HasPrefix(s, r.Lower.(string)) {
+				break
+			}
+		} else if r.Upper != nil {
+			if c := CompareValues(val, r.Upper); c > 0 || (c == 0 && r.UpperOpen) {
+				break
+			}
+		}
+		fn(n.orderedEntry)
+	}
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// configPeople fills a table with names and optional ages, then changes
+// some of them so that the indexes see updates and deletes.
+func configPeople(t *testing.T, indexes ...TableIndex) {
+	Default.Config(DatabaseStore{
+		Tables: []Table{{}},
+		TablesMetaData: []TableMetaData{{Columns: []TableColumn{
+			{Id: 0, Name: "name", Type: StringColumn},
+			{Id: 1, Name: "age", Type: NumberColumn, IsOptional: true},
+		}}},
+	})
+	for _, index := range indexes {
+		if err := Default.CreateIndex(0, index); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(7))
+	names := []string{"al", "alice", "bob", "carol"}
+	person := func() map[ColumnIdType]interface{} {
+		cols := map[ColumnIdType]interface{}{0: names[rnd.Intn(len(names))]}
+		if rnd.Intn(5) > 0 {
+			cols[1] = float64(rnd.Intn(60))
+		}
+		return cols
+	}
+	for i := 0; i < 300; i++ {
+		if _, err := Default.AddNewRow(0, person()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 300; i += 3 {
+		if err := Default.UpdateRow(0, RowIdType(i), person()); err != nil {
+			t.Fatal(err)
+		}
+		if err := Default.DeleteRow(0, RowIdType(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func rangeIds(t *testing.T, index int, r KeyRange, order IndexOrder) []RowIdType {
+	var ids []RowIdType
+	err := Default.ReadTable(0, func(table *Table, _ *TableMetaData) error {
+		rows, ok := table.RangeRows(index, r, order)
+		if !ok {
+			t.Fatal("expected an ordered index")
+		}
+		for _, row := range rows {
+			ids = append(ids, row.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// expectedIds finds the rows with a full scan and sorts them like the index.
+func expectedIds(columns []ColumnIdType, match func(Row[ColumnIdType]) bool, desc bool) []RowIdType {
+	var entries []orderedEntry
+	idx := newOrderedIndex(columns, false)
+	for _, row := range Default.Store.Tables[0].Rows {
+		if !row.Deleted && match(row) {
+			entries = append(entries, idx.entry(row))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if c := compareKeys(entries[i].key, entries[j].key); c != 0 {
+			return (c < 0) != desc
+		}
+		return entries[i].id < entries[j].id
+	})
+	var ids []RowIdType
+	for _, e := range entries {
+		ids = append(ids, e.id)
+	}
+	return ids
+}
+
+func TestOrderedIndexRanges(t *testing.T) {
+	byAge := TableIndex{Kind: OrderedIndex, Columns: []ColumnIdType{1}}
+	byNameAge := TableIndex{Kind: OrderedIndex, Columns: []ColumnIdType{0, 1}}
+	configPeople(t, byAge, byNameAge)
+
+	age := func(row Row[ColumnIdType], test func(float64) bool) bool {
+		v, ok := row.Columns[1]
+		return !ok || test(v.(float64))
+	}
+	tests := []struct {
+		index   int
+		r       KeyRange
+		columns []ColumnIdType
+		match   func(Row[ColumnIdType]) bool
+	}{
+		{0, KeyRange{Bounded: true, Lower: 10.0, LowerOpen: true, Upper: 50.0}, byAge.Columns,
+			func(row Row[ColumnIdType]) bool { return age(row, func(v float64) bool { return v > 10 && v <= 50 }) }},
+		{0, KeyRange{Bounded: true, Upper: 20.0, UpperOpen: true}, byAge.Columns,
+			func(row Row[ColumnIdType]) bool { return age(row, func(v float64) bool { return v < 20 }) }},
+		{0, KeyRange{Equal: []any{33.0}}, byAge.Columns,
+			func(row Row[ColumnIdType]) bool { return age(row, func(v float64) bool { return v == 33 }) }},
+		{1, KeyRange{Equal: []any{"bob"}, Bounded: true, Lower: 20.0}, byNameAge.Columns,
+			func(row Row[ColumnIdType]) bool {
+				return row.Columns[0] == "bob" && age(row, func(v float64) bool { return v >= 20 })
+			}},
+		{1, KeyRange{Bounded: true, Lower: "al", Prefix: true}, byNameAge.Columns,
+			func(row Row[ColumnIdType]) bool { return strings.HasPrefix(row.Columns[0].(string), "al") }},
+		{1, KeyRange{}, byNameAge.Columns,
+			func(row Row[ColumnIdType]) bool { return true }},
+	}
+
+	for i, test := range tests {
+		for _, order := range []IndexOrder{KeyOrder, ReverseKeyOrder} {
+			expected := expectedIds(test.columns, test.match, order == ReverseKeyOrder)
+			if ids := rangeIds(t, test.index, test.r, order); !reflect.DeepEqual(ids, expected) {
+				t.Fatalf("%d: expected: %v, but returned %v", i, expected, ids)
+			}
+		}
+	}
+
+	ids := rangeIds(t, 0, tests[0].r, TableOrder)
+	if !sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] < ids[j] }) || len(ids) != len(expectedIds(byAge.Columns, tests[0].match, false)) {
+		t.Fatalf("expected the rows in the order of the table, but returned %v", ids)
+	}
+}
+
+func TestOrderedIndexChecks(t *testing.T) {
+	configPeople(t)
+	for _, index := range []TableIndex{
+		{Kind: HashIndex, Columns: []ColumnIdType{0, 1}},
+		{Kind: OrderedIndex, Columns: []ColumnIdType{1, 1}},
+		{Kind: OrderedIndex, Columns: []ColumnIdType{2}},
+		{Kind: OrderedIndex},
+		{Kind: 9, Columns: []ColumnIdType{0}},
+	} {
+		if err := Default.CreateIndex(0, index); err == nil {
+			t.Fatalf("expected index %+v to be refused", index)
+		}
+	}
+	if n := len(Default.ListTables()[0].Indexes); n != 0 {
+		t.Fatalf("expected no index, but returned %d", n)
+	}
+}
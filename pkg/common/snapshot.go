@@ -0,0 +1,158 @@
+package common
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const SNAPSHOT_FILE_NAME = "data.bin"
+
+const DEFAULT_SNAPSHOT_INTERVAL = 5 * time.Minute
+const DEFAULT_SNAPSHOT_EVERY = 10000
+
+type Snapshot struct {
+	LSN            uint64 // last log record included in the snapshot
+	Tables         []Table
+	TablesMetaData []TableMetaData
+
+	positionalLog bool // the log after it addresses rows by position, see positionalReplay
+}
+
+type SnapshotInfo struct {
+	LSN     uint64    `json:"lsn"`
+	TakenAt time.Time `json:"taken_at"`
+	Size    int64     `json:"size"`
+}
+
+// Snapshotter periodically dumps the store in background, either every
+// Interval or after Every logged mutations (zero disables the trigger).
+type Snapshotter struct {
+	Interval  time.Duration
+	Every     uint64
+	db        *DB
+	mutations uint64
+	trigger   chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewSnapshotter(db *DB, interval time.Duration, every uint64) *Snapshotter {
+	return &Snapshotter{
+		db:       db,
+		Interval: interval,
+		Every:    every,
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *Snapshotter) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		var tick <-chan time.Time
+		if s.Interval > 0 {
+			ticker := time.NewTicker(s.Interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-tick:
+			case <-s.trigger:
+			}
+			if info, err := s.db.TakeSnapshot(); err != nil {
+				log.Printf("Snapshot failed: %s\n", err)
+			} else {
+				log.Printf("Snapshot of %d bytes was taken at LSN %d\n", info.Size, info.LSN)
+			}
+		}
+	}()
+}
+
+// Stop waits for a running snapshot to finish, no new ones are started.
+func (s *Snapshotter) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *Snapshotter) notify() {
+	if s.Every == 0 {
+		return
+	}
+	if atomic.AddUint64(&s.mutations, 1) >= s.Every {
+		select {
+		case s.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// TakeSnapshot atomically replaces the snapshot file with the current state
+// of the store and discards the log segments it makes redundant.
+func (db *DB) TakeSnapshot() (SnapshotInfo, error) {
+	if db.Disk == nil {
+		return SnapshotInfo{}, ErrNoStorage
+	}
+
+	// an older snapshot written after a newer one truncated the log would
+	// lose the records between them
+	db.snapshotLock.Lock()
+	defer db.snapshotLock.Unlock()
+
+	// no mutation can be half-applied while the catalog is locked exclusively
+	db.catalogLock.Lock()
+	snap := Snapshot{
+		Tables:         db.Store.Tables,
+		TablesMetaData: db.Store.TablesMetaData,
+	}
+	if db.Journal != nil {
+		snap.LSN = db.Journal.LSN()
+	}
+	content, err := encodeSnapshotFile(snap)
+	if err == nil && db.Journal != nil {
+		err = db.Journal.Rotate()
+	}
+	if db.Snapshots != nil {
+		atomic.StoreUint64(&db.Snapshots.mutations, 0)
+	}
+	db.catalogLock.Unlock()
+
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := writeFileAtomic(db.Disk.SnapshotPath(), content); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if db.Journal != nil {
+		if err := db.Journal.Truncate(snap.LSN); err != nil {
+			return SnapshotInfo{}, err
+		}
+	}
+
+	info := SnapshotInfo{
+		LSN:     snap.LSN,
+		TakenAt: time.Now(),
+		Size:    int64(len(content)),
+	}
+	db.setLastSnapshot(info)
+	return info, nil
+}
+
+func (db *DB) LastSnapshot() SnapshotInfo {
+	db.lastSnapshotLock.Lock()
+	defer db.lastSnapshotLock.Unlock()
+	return db.lastSnapshot
+}
+
+func (db *DB) setLastSnapshot(info SnapshotInfo) {
+	db.lastSnapshotLock.Lock()
+	defer db.lastSnapshotLock.Unlock()
+	db.lastSnapshot = info
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Layout of a data directory:
+//
+//	MANIFEST  describes the directory, written once when it is created
+//	LOCK      held exclusively by the process that has the directory open
+//	data.bin  the latest snapshot of the store
+//	wal/      write-ahead log segments newer than the snapshot
+const DEFAULT_DATA_DIR = ".store"
+const MANIFEST_FILE_NAME = "MANIFEST"
+const LOCK_FILE_NAME = "LOCK"
+const LOG_DIR_NAME = "wal"
+
+// written by the releases that kept metadata apart from the snapshot
+const LEGACY_METADATA_FILE_NAME = "metadata.bin"
+
+const STORAGE_LAYOUT_VERSION = 1
+
+var ErrStorageLocked = errors.New("data directory is used by another process")
+var ErrNoStorage = errors.New("data directory is not opened")
+
+type Manifest struct {
+	Layout    int       `json:"layout"`
+	Snapshot  string    `json:"snapshot"`
+	Log       string    `json:"log"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Storage struct {
+	Dir      string
+	Manifest Manifest
+	lock     File
+}
+
+func OpenStorage(dir string) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("data directory %q cannot be created: %w", dir, err)
+	}
+	if err := checkWritable(dir); err != nil {
+		return nil, fmt.Errorf("data directory %q is not writable: %w", dir, err)
+	}
+
+	lock, err := NewFile(filepath.Join(dir, LOCK_FILE_NAME))
+	if err != nil {
+		return nil, fmt.Errorf("data directory %q is not writable: %w", dir, err)
+	}
+	if err := lockFile(lock.Desc); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("%w: %s", ErrStorageLocked, dir)
+	}
+
+	s := &Storage{Dir: dir, lock: lock}
+	if err := s.loadManifest(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if err := os.MkdirAll(s.Path(s.Manifest.Log), 0755); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("data directory %q is not writable: %w", dir, err)
+	}
+	return s, nil
+}
+
+func checkWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func (s *Storage) loadManifest() error {
+	f, err := NewFile(s.Path(MANIFEST_FILE_NAME))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	content, err := f.ReadBytes()
+	if err != nil {
+		return err
+	}
+
+	if len(content) == 0 {
+		s.Manifest = Manifest{
+			Layout:    STORAGE_LAYOUT_VERSION,
+			Snapshot:  SNAPSHOT_FILE_NAME,
+			Log:       LOG_DIR_NAME,
+			CreatedAt: time.Now(),
+		}
+		out, err := json.MarshalIndent(s.Manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		return f.WriteBytes(out)
+	}
+
+	if err := json.Unmarshal(content, &s.Manifest); err != nil {
+		return fmt.Errorf("manifest of %q is damaged: %w", s.Dir, err)
+	}
+	if s.Manifest.Layout > STORAGE_LAYOUT_VERSION {
+		return fmt.Errorf("data directory %q has layout version %d, this build supports up to %d", s.Dir, s.Manifest.Layout, STORAGE_LAYOUT_VERSION)
+	}
+	return nil
+}
+
+func (s *Storage) Path(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+func (s *Storage) SnapshotPath() string {
+	return s.Path(s.Manifest.Snapshot)
+}
+
+func (s *Storage) LogPath() string {
+	return s.Path(s.Manifest.Log)
+}
+
+// Close releases the lock, the directory can be opened by another process afterwards.
+func (s *Storage) Close() error {
+	unlockFile(s.lock.Desc)
+	return s.lock.Close()
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenStorageLayout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	s, err := OpenStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, name := range []string{MANIFEST_FILE_NAME, LOCK_FILE_NAME, LOG_DIR_NAME} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s to be created: %s", name, err)
+		}
+	}
+	if s.SnapshotPath() != filepath.Join(dir, SNAPSHOT_FILE_NAME) {
+		t.Fatalf("unexpected snapshot path %s", s.SnapshotPath())
+	}
+}
+
+func TestOpenStorageLocked(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenStorage(dir); !errors.Is(err, ErrStorageLocked) {
+		t.Fatalf("expected the directory to be locked, but returned %v", err)
+	}
+
+	s.Close()
+	reopened, err := OpenStorage(dir)
+	if err != nil {
+		t.Fatalf("expected the lock to be released: %s", err)
+	}
+	reopened.Close()
+}
+
+func TestCloseWithoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateTable("users"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(filepath.Join(dir, SNAPSHOT_FILE_NAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(filepath.Join(dir, SNAPSHOT_FILE_NAME))
+	if err != nil || !after.ModTime().Equal(before.ModTime()) {
+		t.Fatalf("expected the snapshot not to be written again, but returned %v %v", after, err)
+	}
+}
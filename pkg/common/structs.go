@@ -1,6 +1,9 @@
 package common
 
-import "os"
+import (
+	"os"
+	"sync"
+)
 
 type TableIdType uint8
 type ColumnIdType uint32
@@ -9,37 +12,128 @@ type FilterType map[string][]string
 
 type NewRow struct {
 	Columns map[string]interface{} `json:"columns"`
-	Table   TableIdType            `json:"table"`
+	Table   TableRef               `json:"table"`
+	Tx      TxIdType               `json:"tx"`
 }
 
 type IDecodedJson interface {
-	NewRow | GetRow | NewColumn | UpdateRowData | DeleteRowType
+	NewRow | GetRow | NewColumn | UpdateRowData | DeleteRowType | NewTable | RenameTableData | DropTableType | TxData | QueryData | AggregateData | IndexData | UpsertData
 }
 
+// filter selects rows with a filter document, Key adds the condition that
+// the primary key of the table equals it.
 type filter struct {
-	Filter FilterType `json:"filter"`
+	Filter FilterExpr `json:"filter"`
+	Key    any        `json:"key"`
 }
 
 type GetRow struct {
-	Table TableIdType `json:"table"`
+	Table  TableRef `json:"table"`
+	Tx     TxIdType `json:"tx"`
+	Fields []string `json:"fields"` // columns to send, or to leave out when prefixed with -
 	filter
+	Page
+}
+
+// Page selects which of the found rows are sent and in what order. Rows
+// are sent in pages when a limit, a cursor or the total is asked for.
+type Page struct {
+	Sort   []SortKey `json:"sort"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+	Cursor string    `json:"cursor"`
+	Total  bool      `json:"total"`
+}
+
+type SortKey struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
 }
 
 type UpdateRowData struct {
-	Table   TableIdType            `json:"table"`
+	Table   TableRef               `json:"table"`
 	Colunms map[string]interface{} `json:"columns"`
+	Tx      TxIdType               `json:"tx"`
 	filter
 }
 
+// UpsertData inserts or updates rows by their value of the unique column
+// On, the primary key of the table when it is empty.
+type UpsertData struct {
+	Table TableRef                 `json:"table"`
+	On    string                   `json:"on"`
+	Rows  []map[string]interface{} `json:"rows"`
+	Tx    TxIdType                 `json:"tx"`
+}
+
 type DeleteRowType struct {
-	Table TableIdType `json:"table"`
+	Table TableRef `json:"table"`
+	Tx    TxIdType `json:"tx"`
 	filter
 }
 
+// AggregateData computes the aggregates over the rows matching the filter,
+// for each group of rows with the same values in the group by columns.
+// Having filters the groups by the names of their results.
+type AggregateData struct {
+	Table      TableRef      `json:"table"`
+	Tx         TxIdType      `json:"tx"`
+	Aggregates []Aggregation `json:"aggregates"`
+	GroupBy    []string      `json:"group_by"`
+	Having     FilterExpr    `json:"having"`
+	filter
+}
+
+// Aggregation is one of count, sum, avg, min, max or count_distinct over a
+// column, a count without a column counts rows. As names the result, it is
+// the op and the column joined with _ otherwise.
+type Aggregation struct {
+	Op     string `json:"op"`
+	Column string `json:"column"`
+	As     string `json:"as"`
+}
+
 type NewColumn struct {
-	Name  string      `json:"name"`
-	Table TableIdType `json:"table"`
-	Type  string      `json:"type"`
+	Name     string   `json:"name"`
+	Table    TableRef `json:"table"`
+	Type     string   `json:"type"`
+	Optional bool     `json:"optional"`
+	Unique   bool     `json:"unique"`
+	Primary  bool     `json:"primary"`
+	Tx       TxIdType `json:"tx"`
+}
+
+// IndexData names the indexed columns either with column or, for an
+// ordered index on several of them, with columns. Kind is hash by default.
+type IndexData struct {
+	Table   TableRef `json:"table"`
+	Kind    string   `json:"kind"`
+	Column  string   `json:"column"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+type NewTable struct {
+	Name string `json:"name"`
+}
+
+type RenameTableData struct {
+	Table TableRef `json:"table"`
+	Name  string   `json:"name"`
+}
+
+type DropTableType struct {
+	Table TableRef `json:"table"`
+}
+
+type TxData struct {
+	Tx TxIdType `json:"tx"`
+}
+
+type QueryData struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args"`
+	Tx    TxIdType      `json:"tx"`
 }
 
 type TableColumn struct {
@@ -47,21 +141,32 @@ type TableColumn struct {
 	Name       string       `json:"name"`
 	Type       uint8        `json:"type"`
 	IsOptional bool         `json:"isoptional"`
+	IsUnique   bool         `json:"isunique"`
+	IsPrimary  bool         `json:"isprimary"` // the primary key, it is unique and required
 }
 
 type Row[T ColumnIdType | string] struct {
 	Id      RowIdType         `json:"id"`
 	Columns map[T]interface{} `json:"columns"`
+	Deleted bool              `json:"-"`
 }
 
 type TableMetaData struct {
-	Name    string
-	Columns []TableColumn
+	Id      TableIdType   `json:"id"`
+	Name    string        `json:"name"`
+	Columns []TableColumn `json:"columns"`
+	Indexes []TableIndex  `json:"indexes"`
+	Dropped bool          `json:"-"`
 }
 
 type Table struct {
-	Id   TableIdType
-	Rows []Row[ColumnIdType]
+	Id        TableIdType
+	Rows      []Row[ColumnIdType]
+	NextRowId RowIdType         // ids are never reused, even after a delete
+	index     map[RowIdType]int // row id -> position in Rows
+	deleted   int               // deleted rows still occupying Rows
+	indexes   []rowIndex        // data of TableMetaData.Indexes, in the same order
+	lock      *sync.RWMutex     // shared by copies of the table
 }
 
 type DatabaseStore struct {
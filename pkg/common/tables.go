@@ -0,0 +1,209 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var ErrTableExists = errors.New(ResponseStrings["T2"])
+var ErrTableName = errors.New(ResponseStrings["T3"])
+var ErrTooManyTables = errors.New(ResponseStrings["T4"])
+
+// TableRef addresses a table in requests either by its id or by its name,
+// e.g. `"table": 0` or `"table": "users"`.
+type TableRef struct {
+	Id     TableIdType
+	Name   string
+	ByName bool
+}
+
+func (ref *TableRef) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		ref.ByName = true
+		return json.Unmarshal(data, &ref.Name)
+	}
+	return json.Unmarshal(data, &ref.Id)
+}
+
+func (ref TableRef) MarshalJSON() ([]byte, error) {
+	if ref.ByName {
+		return json.Marshal(ref.Name)
+	}
+	return json.Marshal(ref.Id)
+}
+
+// ParseTableRef reads a table given as text, e.g. in a query string or on
+// the command line: a number that fits a table id is an id, anything else a
+// name.
+func ParseTableRef(s string) TableRef {
+	if id, err := strconv.ParseUint(s, 10, 8); err == nil {
+		return TableRef{Id: TableIdType(id)}
+	}
+	return TableRef{Name: s, ByName: true}
+}
+
+func (db *DB) TableExists(tid TableIdType) bool {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+	return db.tableExists(tid)
+}
+
+func (db *DB) tableExists(tid TableIdType) bool {
+	return int(tid) < len(db.Store.Tables) &&
+		int(tid) < len(db.Store.TablesMetaData) &&
+		!db.Store.TablesMetaData[tid].Dropped
+}
+
+func (db *DB) FindTableByName(name string) (TableIdType, error) {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+	return db.findTable(name)
+}
+
+func (db *DB) findTable(name string) (TableIdType, error) {
+	for idx, meta := range db.Store.TablesMetaData {
+		if !meta.Dropped && meta.Name == name {
+			return TableIdType(idx), nil
+		}
+	}
+	return 0, fmt.Errorf(ResponseStrings["T5"])
+}
+
+func (db *DB) ResolveTable(ref TableRef) (TableIdType, error) {
+	if ref.ByName {
+		return db.FindTableByName(ref.Name)
+	}
+	if !db.TableExists(ref.Id) {
+		return 0, fmt.Errorf(ResponseStrings["T1"])
+	}
+	return ref.Id, nil
+}
+
+func (db *DB) ListTables() []TableMetaData {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+
+	tables := []TableMetaData{}
+	for _, meta := range db.Store.TablesMetaData {
+		if !meta.Dropped {
+			meta.Columns = append([]TableColumn{}, meta.Columns...)
+			meta.Indexes = append([]TableIndex{}, meta.Indexes...)
+			tables = append(tables, meta)
+		}
+	}
+	return tables
+}
+
+func (db *DB) checkTableName(name string) error {
+	if name == "" {
+		return ErrTableName
+	}
+	if _, err := db.findTable(name); err == nil {
+		return ErrTableExists
+	}
+	return nil
+}
+
+func (db *DB) CreateTable(name string) (TableIdType, error) {
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	if err := db.checkTableName(name); err != nil {
+		return 0, err
+	}
+	tid, err := db.freeTableId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.writeLog(LogRecord{
+		Op:    LogNewTable,
+		Table: tid,
+		Name:  name,
+	}); err != nil {
+		return 0, err
+	}
+
+	table := Table{Id: tid}
+	table.init()
+	meta := TableMetaData{Id: tid, Name: name}
+	if int(tid) < len(db.Store.Tables) {
+		db.Store.Tables[tid] = table
+		db.Store.TablesMetaData[tid] = meta
+	} else {
+		db.Store.Tables = append(db.Store.Tables, table)
+		db.Store.TablesMetaData = append(db.Store.TablesMetaData, meta)
+	}
+
+	return tid, nil
+}
+
+// freeTableId is the id of a new table. The slot of a dropped table is only
+// given again when every id is taken, so a dropped id stays unknown as long
+// as possible.
+func (db *DB) freeTableId() (TableIdType, error) {
+	if len(db.Store.Tables) <= math.MaxUint8 {
+		return TableIdType(len(db.Store.Tables)), nil
+	}
+	for idx, meta := range db.Store.TablesMetaData {
+		if meta.Dropped {
+			return TableIdType(idx), nil
+		}
+	}
+	return 0, ErrTooManyTables
+}
+
+func (db *DB) RenameTable(tid TableIdType, name string) error {
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	if !db.tableExists(tid) {
+		return fmt.Errorf(ResponseStrings["T1"])
+	}
+	if db.Store.TablesMetaData[tid].Name == name {
+		return nil
+	}
+	if err := db.checkTableName(name); err != nil {
+		return err
+	}
+
+	if err := db.writeLog(LogRecord{
+		Op:    LogRenameTable,
+		Table: tid,
+		Name:  name,
+	}); err != nil {
+		return err
+	}
+
+	db.Store.TablesMetaData[tid].Name = name
+
+	return nil
+}
+
+// DropTable removes the table with all its rows. Its id is given to another
+// table only once all the others are taken, see freeTableId.
+func (db *DB) DropTable(tid TableIdType) error {
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	if !db.tableExists(tid) {
+		return fmt.Errorf(ResponseStrings["T1"])
+	}
+
+	if err := db.writeLog(LogRecord{
+		Op:    LogDropTable,
+		Table: tid,
+	}); err != nil {
+		return err
+	}
+
+	db.Store.Tables[tid].Rows = nil
+	db.Store.Tables[tid].Reindex()
+	db.Store.Tables[tid].indexes = nil
+	db.Store.TablesMetaData[tid] = TableMetaData{Id: tid, Dropped: true}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func configTables() {
+	Default.Config(DatabaseStore{
+		Tables:         []Table{{}},
+		TablesMetaData: []TableMetaData{{}},
+	})
+}
+
+func TestCreateTable(t *testing.T) {
+	configTables()
+	tid, err := Default.CreateTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tid != 1 {
+		t.Fatalf("expected table id 1, but returned %d", tid)
+	}
+	if _, err := Default.CreateTable("users"); !errors.Is(err, ErrTableExists) {
+		t.Fatalf("expected duplicate name to be refused, but returned %v", err)
+	}
+	if _, err := Default.CreateTable(""); !errors.Is(err, ErrTableName) {
+		t.Fatalf("expected empty name to be refused, but returned %v", err)
+	}
+}
+
+func TestRenameAndDropTable(t *testing.T) {
+	configTables()
+	users, _ := Default.CreateTable("users")
+	orders, _ := Default.CreateTable("orders")
+
+	if err := Default.RenameTable(users, "orders"); !errors.Is(err, ErrTableExists) {
+		t.Fatalf("expected rename onto an existing name to be refused, but returned %v", err)
+	}
+	if err := Default.RenameTable(users, "customers"); err != nil {
+		t.Fatal(err)
+	}
+	if tid, err := Default.ResolveTable(TableRef{Name: "customers", ByName: true}); err != nil || tid != users {
+		t.Fatalf("expected customers to resolve to %d, but returned %d (%v)", users, tid, err)
+	}
+
+	if err := Default.DropTable(orders); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Default.ResolveTable(TableRef{Id: orders}); err == nil {
+		t.Fatal("expected dropped table not to be resolved")
+	}
+	if tid, _ := Default.CreateTable("orders"); tid == orders {
+		t.Fatal("expected the id of a dropped table not to be reused")
+	}
+	if n := len(Default.ListTables()); n != 3 {
+		t.Fatalf("expected 3 tables to be listed, but returned %d", n)
+	}
+}
+
+func TestReuseDroppedTables(t *testing.T) {
+	configTables()
+	for i := 1; i <= math.MaxUint8; i++ {
+		if _, err := Default.CreateTable(fmt.Sprint("t", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Default.CreateTable("full"); !errors.Is(err, ErrTooManyTables) {
+		t.Fatalf("expected: %v, but returned %v", ErrTooManyTables, err)
+	}
+
+	for round := 0; round < 3; round++ {
+		if err := Default.DropTable(7); err != nil {
+			t.Fatal(err)
+		}
+		tid, err := Default.CreateTable("again")
+		if err != nil || tid != 7 {
+			t.Fatalf("expected: 7, but returned %d %v", tid, err)
+		}
+		if rid, err := Default.AddNewRow(tid, map[ColumnIdType]interface{}{}); err != nil || rid != 0 {
+			t.Fatalf("expected a new empty table, but returned %d %v", rid, err)
+		}
+		if err := Default.RenameTable(tid, "t7"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTableRefJSON(t *testing.T) {
+	var data struct {
+		ById   TableRef `json:"by_id"`
+		ByName TableRef `json:"by_name"`
+	}
+	if err := json.Unmarshal([]byte(`{"by_id": 2, "by_name": "users"}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.ById != (TableRef{Id: 2}) || data.ByName != (TableRef{Name: "users", ByName: true}) {
+		t.Fatalf("unexpected refs %+v", data)
+	}
+}
+
+func TestParseTableRef(t *testing.T) {
+	for param, expected := range map[string]TableRef{
+		"2":     {Id: 2},
+		"255":   {Id: 255},
+		"256":   {Name: "256", ByName: true},
+		"-1":    {Name: "-1", ByName: true},
+		"users": {Name: "users", ByName: true},
+	} {
+		if ref := ParseTableRef(param); ref != expected {
+			t.Fatalf("%s: expected: %+v, but returned %+v", param, expected, ref)
+		}
+	}
+}
@@ -0,0 +1,520 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type TxIdType uint64
+
+const DEFAULT_TX_TIMEOUT = 30 * time.Second
+
+var ErrTxNotFound = errors.New(ResponseStrings["X1"])
+
+// TxAbortedError is returned by a commit that could not be applied, e.g.
+// because a row it changes was deleted meanwhile. Nothing of it was applied.
+type TxAbortedError struct {
+	Err error
+}
+
+func (e *TxAbortedError) Error() string {
+	return fmt.Sprintf("%s: %s", ResponseStrings["X2"], e.Err)
+}
+
+func (e *TxAbortedError) Unwrap() error {
+	return e.Err
+}
+
+// Tx buffers row and column operations until it is committed. Other clients
+// only see committed data, the transaction sees committed data with its own
+// changes on top (read committed). On commit every operation is applied at
+// once and written to the log as a single record.
+type Tx struct {
+	Id      TxIdType
+	db      *DB
+	mu      sync.Mutex
+	ops     []LogRecord
+	tables  map[TableIdType]*txTable
+	expires time.Time
+}
+
+// txTable is how a table changed by the transaction looks like to it.
+type txTable struct {
+	base     int           // committed columns the new ones are appended to
+	columns  []TableColumn // columns created by the transaction
+	rows     map[RowIdType]Row[ColumnIdType]
+	inserted []RowIdType
+	deleted  map[RowIdType]bool
+}
+
+// TxManager keeps the open transactions and aborts the ones that were not
+// used for longer than Timeout, zero disables the timeout.
+type TxManager struct {
+	Timeout time.Duration
+	db      *DB
+	mu      sync.Mutex
+	nextId  TxIdType
+	active  map[TxIdType]*Tx
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewTxManager(db *DB, timeout time.Duration) *TxManager {
+	return &TxManager{
+		Timeout: timeout,
+		db:      db,
+		active:  make(map[TxIdType]*Tx),
+	}
+}
+
+func (m *TxManager) Begin() *Tx {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextId++
+	tx := &Tx{
+		Id:      m.nextId,
+		db:      m.db,
+		tables:  make(map[TableIdType]*txTable),
+		expires: time.Now().Add(m.Timeout),
+	}
+	m.active[tx.Id] = tx
+	return tx
+}
+
+// Get returns an open transaction and postpones its timeout.
+func (m *TxManager) Get(id TxIdType) (*Tx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, ok := m.active[id]
+	if !ok {
+		return nil, ErrTxNotFound
+	}
+	if m.expired(tx, time.Now()) {
+		delete(m.active, id)
+		return nil, ErrTxNotFound
+	}
+	tx.expires = time.Now().Add(m.Timeout)
+	return tx, nil
+}
+
+// Commit applies the transaction, it is closed whether it succeeds or not.
+func (m *TxManager) Commit(id TxIdType) error {
+	tx, err := m.take(id)
+	if err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Rollback discards the transaction.
+func (m *TxManager) Rollback(id TxIdType) error {
+	_, err := m.take(id)
+	return err
+}
+
+func (m *TxManager) take(id TxIdType) (*Tx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, ok := m.active[id]
+	if !ok {
+		return nil, ErrTxNotFound
+	}
+	delete(m.active, id)
+	if m.expired(tx, time.Now()) {
+		return nil, ErrTxNotFound
+	}
+	return tx, nil
+}
+
+// Start aborts expired transactions in background until Stop is called.
+func (m *TxManager) Start() {
+	if m.Timeout <= 0 {
+		return
+	}
+	m.done = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		period := m.Timeout / 2
+		if period < time.Second {
+			period = time.Second
+		}
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.expire()
+			}
+		}
+	}()
+}
+
+func (m *TxManager) Stop() {
+	if m.done == nil {
+		return
+	}
+	close(m.done)
+	m.wg.Wait()
+}
+
+// expired tells if the transaction timed out, a zero Timeout disables it.
+func (m *TxManager) expired(tx *Tx, now time.Time) bool {
+	return m.Timeout > 0 && now.After(tx.expires)
+}
+
+func (m *TxManager) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, tx := range m.active {
+		if m.expired(tx, now) {
+			delete(m.active, id)
+			log.Printf("Transaction %d was aborted after timeout\n", id)
+		}
+	}
+}
+
+// view returns the table as changed by the transaction, creating it if needed.
+func (tx *Tx) view(tid TableIdType) *txTable {
+	view, ok := tx.tables[tid]
+	if !ok {
+		view = &txTable{
+			rows:    make(map[RowIdType]Row[ColumnIdType]),
+			deleted: make(map[RowIdType]bool),
+		}
+		tx.tables[tid] = view
+	}
+	return view
+}
+
+func (v *txTable) viewColumns(meta *TableMetaData) []TableColumn {
+	if v == nil || len(v.columns) == 0 {
+		return meta.Columns
+	}
+	columns := make([]TableColumn, 0, v.base+len(v.columns))
+	columns = append(columns, meta.Columns[:v.base]...)
+	return append(columns, v.columns...)
+}
+
+// row finds a row visible to the transaction.
+func (v *txTable) row(table *Table, rid RowIdType) (Row[ColumnIdType], bool) {
+	if v.deleted[rid] {
+		return Row[ColumnIdType]{}, false
+	}
+	if row, ok := v.rows[rid]; ok {
+		return row, true
+	}
+	pos, ok := table.rowPosition(rid)
+	if !ok {
+		return Row[ColumnIdType]{}, false
+	}
+	return table.Rows[pos], true
+}
+
+// ReadTable runs fn with the rows and columns of the table as the transaction
+// sees them, the same rules as for DB.ReadTable apply.
+func (tx *Tx) ReadTable(tid TableIdType, fn func(rows []Row[ColumnIdType], columns []TableColumn) error) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.db.ReadTable(tid, func(table *Table, meta *TableMetaData) error {
+		view, ok := tx.tables[tid]
+		if !ok {
+			return fn(table.Rows, meta.Columns)
+		}
+
+		rows := make([]Row[ColumnIdType], 0, len(table.Rows)+len(view.inserted))
+		for _, row := range table.Rows {
+			if row.Deleted || view.deleted[row.Id] {
+				continue
+			}
+			if changed, ok := view.rows[row.Id]; ok {
+				row = changed
+			}
+			rows = append(rows, row)
+		}
+		for _, rid := range view.inserted {
+			rows = append(rows, view.rows[rid])
+		}
+		return fn(rows, view.viewColumns(meta))
+	})
+}
+
+// PrepareColumns is DB.PrepareColumns against the columns the transaction sees.
+func (tx *Tx) PrepareColumns(tid TableIdType, values map[string]interface{}, partial bool) (map[ColumnIdType]interface{}, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	var cols map[ColumnIdType]interface{}
+	err := tx.db.ReadTable(tid, func(_ *Table, meta *TableMetaData) error {
+		var err error
+		cols, err = prepareColumns(tx.tables[tid].viewColumns(meta), values, partial)
+		return err
+	})
+	return cols, err
+}
+
+func (tx *Tx) AddRow(tid TableIdType, cols map[ColumnIdType]interface{}) (RowIdType, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	var values map[ColumnIdType]interface{}
+	err := tx.db.ReadTable(tid, func(_ *Table, meta *TableMetaData) error {
+		var err error
+		values, err = validateRow(tx.tables[tid].viewColumns(meta), cols)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return tx.insert(tid, values)
+}
+
+// InsertRows is DB.InsertRows in the transaction. Every row is checked
+// before any is added, so with atomic a wrong row leaves the transaction as
+// it was.
+func (tx *Tx) InsertRows(tid TableIdType, rows []map[ColumnIdType]interface{}, atomic bool) (ids []RowIdType, errs []error, err error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	values := make([]map[ColumnIdType]interface{}, len(rows))
+	errs = make([]error, len(rows))
+	failed := false
+	err = tx.db.ReadTable(tid, func(_ *Table, meta *TableMetaData) error {
+		columns := tx.tables[tid].viewColumns(meta)
+		for i, cols := range rows {
+			if values[i], errs[i] = validateRow(columns, cols); errs[i] != nil {
+				failed = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if atomic && failed {
+		return nil, errs, nil
+	}
+
+	ids = make([]RowIdType, len(rows))
+	for i := range rows {
+		if errs[i] != nil {
+			continue
+		}
+		if ids[i], err = tx.insert(tid, values[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, errs, nil
+}
+
+// insert adds a validated row to the view of the table.
+func (tx *Tx) insert(tid TableIdType, values map[ColumnIdType]interface{}) (RowIdType, error) {
+	// the id is taken right away so concurrent inserts don't get the same one
+	rid, err := tx.db.reserveRowId(tid)
+	if err != nil {
+		return 0, err
+	}
+
+	view := tx.view(tid)
+	view.rows[rid] = Row[ColumnIdType]{Id: rid, Columns: values}
+	view.inserted = append(view.inserted, rid)
+	tx.ops = append(tx.ops, LogRecord{
+		Op:      LogInsertRow,
+		Table:   tid,
+		Row:     rid,
+		Columns: values,
+	})
+	return rid, nil
+}
+
+// UpdateRows changes all the rows or none of them, like DB.UpdateRows.
+func (tx *Tx) UpdateRows(tid TableIdType, rids []RowIdType, diff map[ColumnIdType]interface{}) ([]RowIdType, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	view := tx.view(tid)
+	changed := make([]Row[ColumnIdType], 0, len(rids))
+	err := tx.db.ReadTable(tid, func(table *Table, meta *TableMetaData) error {
+		var failed []RowIdType
+		seen := make(map[RowIdType]bool, len(rids))
+		for _, rid := range rids {
+			row, ok := view.row(table, rid)
+			if !ok || seen[rid] {
+				failed = append(failed, rid)
+				continue
+			}
+			seen[rid] = true
+			changed = append(changed, row.clone())
+		}
+		if len(failed) > 0 {
+			return &RowsNotFoundError{failed}
+		}
+
+		var err error
+		diff, err = validateDiff(view.viewColumns(meta), diff)
+		return err
+	})
+	if err != nil {
+		return failedRows(err), err
+	}
+
+	for _, row := range changed {
+		for id, val := range diff {
+			if val == nil {
+				delete(row.Columns, id)
+			} else {
+				row.Columns[id] = val
+			}
+		}
+		view.rows[row.Id] = row
+	}
+	if len(rids) == 0 {
+		return nil, nil
+	}
+	tx.ops = append(tx.ops, LogRecord{
+		Op:      LogUpdateRows,
+		Table:   tid,
+		Rows:    rids,
+		Columns: diff,
+	})
+	return nil, nil
+}
+
+// DeleteRows removes all the rows or none of them, like DB.DeleteRows.
+func (tx *Tx) DeleteRows(tid TableIdType, rids []RowIdType) ([]RowIdType, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	view := tx.view(tid)
+	err := tx.db.ReadTable(tid, func(table *Table, _ *TableMetaData) error {
+		var failed []RowIdType
+		seen := make(map[RowIdType]bool, len(rids))
+		for _, rid := range rids {
+			if _, ok := view.row(table, rid); !ok || seen[rid] {
+				failed = append(failed, rid)
+				continue
+			}
+			seen[rid] = true
+		}
+		if len(failed) > 0 {
+			return &RowsNotFoundError{failed}
+		}
+		return nil
+	})
+	if err != nil {
+		return failedRows(err), err
+	}
+
+	for _, rid := range rids {
+		view.deleted[rid] = true
+		delete(view.rows, rid)
+	}
+	inserted := view.inserted[:0]
+	for _, rid := range view.inserted {
+		if !view.deleted[rid] {
+			inserted = append(inserted, rid)
+		}
+	}
+	view.inserted = inserted
+
+	if len(rids) == 0 {
+		return nil, nil
+	}
+	tx.ops = append(tx.ops, LogRecord{
+		Op:    LogDeleteRows,
+		Table: tid,
+		Rows:  rids,
+	})
+	return nil, nil
+}
+
+func (tx *Tx) CreateColumn(tid TableIdType, name string, colType uint8, optional bool) (ColumnIdType, error) {
+	return tx.AddColumn(tid, TableColumn{Name: name, Type: colType, IsOptional: optional})
+}
+
+// AddColumn adds a column visible to the transaction only. If another
+// column was committed to the table in the meantime the commit fails, as
+// it does when a primary key can't be added then.
+func (tx *Tx) AddColumn(tid TableIdType, col TableColumn) (ColumnIdType, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if col.Type >= uint8(len(ColumnsTypeEnum)) {
+		return 0, fmt.Errorf(ResponseStrings["C1"])
+	}
+
+	view := tx.view(tid)
+	err := tx.db.ReadTable(tid, func(table *Table, meta *TableMetaData) error {
+		columns := view.viewColumns(meta)
+		if _, err := findColumn(columns, col.Name); err == nil {
+			return fmt.Errorf(ResponseStrings["C3"])
+		}
+		if col.IsPrimary {
+			if err := checkPrimaryKey(table, &TableMetaData{Columns: columns}, col.IsOptional); err != nil {
+				return err
+			}
+		}
+		if len(view.columns) == 0 {
+			view.base = len(columns)
+		}
+		col.Id = ColumnIdType(len(columns))
+		col.IsUnique = col.IsUnique || col.IsPrimary
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	view.columns = append(view.columns, col)
+	tx.ops = append(tx.ops, LogRecord{
+		Op:       LogNewColumn,
+		Table:    tid,
+		Column:   col.Id,
+		Name:     col.Name,
+		Type:     col.Type,
+		Optional: col.IsOptional,
+		Unique:   col.IsUnique,
+		Primary:  col.IsPrimary,
+	})
+	return col.Id, nil
+}
+
+func (tx *Tx) commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	tx.db.catalogLock.Lock()
+	defer tx.db.catalogLock.Unlock()
+
+	undo, tables, err := tx.db.applyBatch(tx.ops)
+	if err != nil {
+		return &TxAbortedError{err}
+	}
+	if err := tx.db.writeLog(LogRecord{Op: LogCommit, Batch: tx.ops}); err != nil {
+		undo()
+		return err
+	}
+
+	for _, tid := range tables {
+		tx.db.Store.Tables[tid].compact()
+	}
+	return nil
+}
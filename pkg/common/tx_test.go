@@ -0,0 +1,190 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func visibleNames(t *testing.T, tx *Tx) []string {
+	var names []string
+	err := tx.ReadTable(0, func(rows []Row[ColumnIdType], _ []TableColumn) error {
+		for _, row := range rows {
+			if !row.Deleted {
+				names = append(names, row.Columns[0].(string))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestTxIsolation(t *testing.T) {
+	configRows(t, "a", "b")
+	m := NewTxManager(Default, time.Minute)
+	tx := m.Begin()
+
+	rid, err := tx.AddRow(0, map[ColumnIdType]interface{}{0: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateRows(0, []RowIdType{0}, map[ColumnIdType]interface{}{0: "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.DeleteRows(0, []RowIdType{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := visibleNames(t, tx); len(names) != 2 || names[0] != "z" || names[1] != "c" {
+		t.Fatalf("expected the transaction to see [z c], but returned %v", names)
+	}
+	if _, err := Default.GetRowById(0, rid); err == nil {
+		t.Fatal("expected an uncommitted row not to be visible")
+	}
+	if row, _ := Default.GetRowById(0, 0); row.Columns[0] != "a" {
+		t.Fatalf("expected an uncommitted update not to be visible, but returned %+v", row)
+	}
+
+	if err := m.Commit(tx.Id); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := Default.GetRowById(0, rid); err != nil || row.Columns[0] != "c" {
+		t.Fatalf("expected committed row %d, but returned %+v, %v", rid, row, err)
+	}
+	if row, _ := Default.GetRowById(0, 0); row.Columns[0] != "z" {
+		t.Fatalf("expected a committed update, but returned %+v", row)
+	}
+	if _, err := Default.GetRowById(0, 1); err == nil {
+		t.Fatal("expected a committed delete")
+	}
+	if err := m.Commit(tx.Id); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("expected a second commit to fail, but returned %v", err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	configRows(t, "a")
+	m := NewTxManager(Default, time.Minute)
+	tx := m.Begin()
+
+	if _, err := tx.CreateColumn(0, "age", NumberColumn, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.AddRow(0, map[ColumnIdType]interface{}{0: "b", 1: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Rollback(tx.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Default.FindColumnByName(0, "age"); err == nil {
+		t.Fatal("expected a rolled back column not to exist")
+	}
+	if n := len(Default.Store.Tables[0].Rows); n != 1 {
+		t.Fatalf("expected 1 row, but there are %d", n)
+	}
+}
+
+func TestTxInsertRows(t *testing.T) {
+	configRows(t, "a")
+	m := NewTxManager(Default, time.Minute)
+	tx := m.Begin()
+
+	rows := []map[ColumnIdType]interface{}{{0: "b"}, {0: 1}, {0: "c"}}
+	ids, errs, err := tx.InsertRows(0, rows, true)
+	if err != nil || ids != nil || errs[0] != nil || errs[1] == nil {
+		t.Fatalf("expected the second row to fail, but returned %v %v %v", ids, errs, err)
+	}
+	if names := visibleNames(t, tx); len(names) != 1 {
+		t.Fatalf("expected: [a], but returned %v", names)
+	}
+
+	ids, errs, err = tx.InsertRows(0, rows, false)
+	if err != nil || errs[1] == nil || ids[0] == ids[2] {
+		t.Fatalf("expected the other rows to be inserted, but returned %v %v %v", ids, errs, err)
+	}
+	if names := visibleNames(t, tx); len(names) != 3 || names[1] != "b" || names[2] != "c" {
+		t.Fatalf("expected: [a b c], but returned %v", names)
+	}
+}
+
+func TestTxCommitConflict(t *testing.T) {
+	configRows(t, "a")
+	m := NewTxManager(Default, time.Minute)
+	tx := m.Begin()
+
+	if _, err := tx.AddRow(0, map[ColumnIdType]interface{}{0: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateRows(0, []RowIdType{0}, map[ColumnIdType]interface{}{0: "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.DeleteRow(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var aborted *TxAbortedError
+	if err := m.Commit(tx.Id); !errors.As(err, &aborted) {
+		t.Fatalf("expected the commit to be aborted, but returned %v", err)
+	}
+	if n := len(Default.Store.Tables[0].index); n != 0 {
+		t.Fatalf("expected no rows after an aborted commit, but there are %d", n)
+	}
+}
+
+func TestTxTimeout(t *testing.T) {
+	configRows(t)
+	m := NewTxManager(Default, time.Millisecond)
+	tx := m.Begin()
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := m.Get(tx.Id); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("expected an expired transaction, but returned %v", err)
+	}
+	if err := m.Commit(tx.Id); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("expected an expired transaction not to commit, but returned %v", err)
+	}
+}
+
+func TestTxCommitReplay(t *testing.T) {
+	configRows(t, "a")
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	Default.Journal = wal
+	defer func() { Default.Journal = nil }()
+
+	m := NewTxManager(Default, time.Minute)
+	tx := m.Begin()
+	if _, err := tx.CreateColumn(0, "age", NumberColumn, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateRows(0, []RowIdType{0}, map[ColumnIdType]interface{}{1: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.AddRow(0, map[ColumnIdType]interface{}{0: "b", 1: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Commit(tx.Id); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+	Default.Journal = nil
+
+	records := replayAll(t, openTestLog(t, dir), 0)
+	if len(records) != 1 || records[0].Op != LogCommit || len(records[0].Batch) != 3 {
+		t.Fatalf("expected a single commit record, but returned %+v", records)
+	}
+
+	configRows(t, "a")
+	if err := Default.ApplyLogRecord(records[0]); err != nil {
+		t.Fatal(err)
+	}
+	row, err := Default.GetRowById(0, 1)
+	if err != nil || row.Columns[1] != 8.0 {
+		t.Fatalf("expected the replayed row, but returned %+v, %v", row, err)
+	}
+}
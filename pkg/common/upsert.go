@@ -0,0 +1,188 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUpsertKey = errors.New(ResponseStrings["U2"])
+var ErrNoKeyValue = errors.New(ResponseStrings["U3"])
+
+// UpsertResult tells what happened to a row of an upsert.
+type UpsertResult struct {
+	Id       RowIdType `json:"id"`
+	Inserted bool      `json:"inserted"` // false when an existing row was updated
+}
+
+// UpsertRows inserts each row whose value of the key column no row holds
+// yet and updates the row holding it otherwise, with the given columns
+// only. The key column must be unique. All the rows are written or none of
+// them, in a single record of the log, and other writers of the table wait
+// meanwhile so a key is never inserted twice.
+func (db *DB) UpsertRows(tid TableIdType, key ColumnIdType, rows []map[ColumnIdType]interface{}) ([]UpsertResult, error) {
+	results := make([]UpsertResult, len(rows))
+	err := db.writeTable(tid, func(table *Table) error {
+		meta := &db.Store.TablesMetaData[tid]
+		idx, err := table.keyIndex(meta, key)
+		if err != nil {
+			return err
+		}
+
+		batch := make([]LogRecord, 0, len(rows))
+		undos := make([]func(), 0, len(rows))
+		undoAll := func() {
+			for i := len(undos) - 1; i >= 0; i-- {
+				undos[i]()
+			}
+		}
+		for i, cols := range rows {
+			val, err := keyValue(meta.Columns[key], cols)
+			if err != nil {
+				undoAll()
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+
+			rec := LogRecord{Op: LogInsertRow, Table: tid, Row: table.NextRowId, Columns: cols}
+			if rid, ok := idx.lookup(val); ok {
+				rec = LogRecord{Op: LogUpdateRow, Table: tid, Row: rid, Columns: cols}
+			}
+			undo, err := db.applyRecord(&rec)
+			if err != nil {
+				undoAll()
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+			undos = append(undos, undo)
+			batch = append(batch, rec)
+			results[i] = UpsertResult{Id: rec.Row, Inserted: rec.Op == LogInsertRow}
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := db.writeLog(LogRecord{Op: LogCommit, Batch: batch}); err != nil {
+			undoAll()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// UpsertRows is DB.UpsertRows against the rows the transaction sees. Other
+// transactions inserting the same key make the later commit fail.
+func (tx *Tx) UpsertRows(tid TableIdType, key ColumnIdType, rows []map[ColumnIdType]interface{}) ([]UpsertResult, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	type upsert struct {
+		values map[ColumnIdType]interface{}
+		row    Row[ColumnIdType] // the row to update, Id is unset for an insert
+		update bool
+		first  int // the earlier row of the batch with the key, or -1
+	}
+	view := tx.view(tid)
+	upserts := make([]upsert, len(rows))
+	err := tx.db.ReadTable(tid, func(table *Table, meta *TableMetaData) error {
+		columns := view.viewColumns(meta)
+		if int(key) >= len(columns) || !columns[key].IsUnique {
+			return ErrUpsertKey
+		}
+
+		byKey := make(map[interface{}]RowIdType)
+		for _, row := range table.Rows {
+			if row, ok := view.row(table, row.Id); ok && row.Columns[key] != nil {
+				byKey[row.Columns[key]] = row.Id
+			}
+		}
+		for _, rid := range view.inserted {
+			if val := view.rows[rid].Columns[key]; val != nil {
+				byKey[val] = rid
+			}
+		}
+
+		// a key repeated in the batch updates the row as left by its earlier
+		// row, which is only known when they are applied
+		seen := make(map[interface{}]int)
+		for i, cols := range rows {
+			val, err := keyValue(columns[key], cols)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+
+			u := upsert{first: -1}
+			if first, ok := seen[val]; ok {
+				u.first, u.update = first, true
+			} else if rid, ok := byKey[val]; ok {
+				u.row, _ = view.row(table, rid)
+				u.row, u.update = u.row.clone(), true
+				seen[val] = i
+			} else {
+				seen[val] = i
+			}
+
+			if u.update {
+				u.values, err = validateDiff(columns, cols)
+			} else {
+				u.values, err = validateRow(columns, cols)
+			}
+			if err != nil {
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+			upserts[i] = u
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]UpsertResult, len(rows))
+	for i := range upserts {
+		u := &upserts[i]
+		if u.update {
+			continue
+		}
+		// the id is taken right away so concurrent inserts don't get the same one
+		if u.row.Id, err = tx.db.reserveRowId(tid); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, u := range upserts {
+		if !u.update {
+			view.rows[u.row.Id] = Row[ColumnIdType]{Id: u.row.Id, Columns: u.values}
+			view.inserted = append(view.inserted, u.row.Id)
+			tx.ops = append(tx.ops, LogRecord{Op: LogInsertRow, Table: tid, Row: u.row.Id, Columns: u.values})
+			results[i] = UpsertResult{Id: u.row.Id, Inserted: true}
+			continue
+		}
+
+		row := u.row
+		if u.first >= 0 {
+			row = view.rows[upserts[u.first].row.Id].clone()
+		}
+		for id, val := range u.values {
+			if val == nil {
+				delete(row.Columns, id)
+			} else {
+				row.Columns[id] = val
+			}
+		}
+		view.rows[row.Id] = row
+		tx.ops = append(tx.ops, LogRecord{Op: LogUpdateRow, Table: tid, Row: row.Id, Columns: u.values})
+		results[i] = UpsertResult{Id: row.Id}
+	}
+	return results, nil
+}
+
+// keyValue converts the value of the key column given for a row.
+func keyValue(col TableColumn, cols map[ColumnIdType]interface{}) (interface{}, error) {
+	val := cols[col.Id]
+	if val == nil {
+		return nil, ErrNoKeyValue
+	}
+	return ConvertValue(val, col.Type)
+}
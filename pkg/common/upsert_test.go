@@ -0,0 +1,166 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// configAccounts makes a table of unique names with an optional count.
+func configAccounts(t *testing.T, names ...string) ColumnIdType {
+	Default.Config(DatabaseStore{
+		Tables: []Table{{}},
+		TablesMetaData: []TableMetaData{{
+			Columns: []TableColumn{{Id: 0, Name: "name", Type: StringColumn, IsUnique: true}},
+			Indexes: []TableIndex{{Kind: HashIndex, Columns: []ColumnIdType{0}, Unique: true}},
+		}},
+	})
+	for _, name := range names {
+		if _, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := Default.CreateNewColumn(0, "count", NumberColumn, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestUpsertRows(t *testing.T) {
+	count := configAccounts(t, "a", "b")
+	results, err := Default.UpsertRows(0, 0, []map[ColumnIdType]interface{}{
+		{0: "b", count: 1},
+		{0: "c", count: 2},
+		{0: "c", count: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []UpsertResult{{Id: 1}, {Id: 2, Inserted: true}, {Id: 2}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, results)
+	}
+	if row, _ := Default.GetRowById(0, 2); row.Columns[count] != 3.0 {
+		t.Fatalf("expected the second upsert of c to update it, but returned %+v", row)
+	}
+
+	// a failing row leaves every row as it was
+	for _, rows := range [][]map[ColumnIdType]interface{}{
+		{{0: "d"}, {count: 4}},
+		{{0: "a", count: 5}, {0: "e", count: "x"}},
+	} {
+		if _, err := Default.UpsertRows(0, 0, rows); err == nil {
+			t.Fatalf("expected %v to fail", rows)
+		}
+	}
+	if row, _ := Default.GetRowById(0, 0); row.Columns[count] != nil {
+		t.Fatalf("expected row 0 to stay without a count, but returned %+v", row)
+	}
+	if rows := Default.Store.Tables[0].Rows; len(rows) != 3 {
+		t.Fatalf("expected no row to be inserted, but returned %+v", rows)
+	}
+
+	if _, err := Default.UpsertRows(0, count, []map[ColumnIdType]interface{}{{count: 1}}); !errors.Is(err, ErrUpsertKey) {
+		t.Fatalf("expected a column that isn't unique to be refused, but returned %v", err)
+	}
+}
+
+func TestUpsertConcurrent(t *testing.T) {
+	count := configAccounts(t)
+	keys := []string{"a", "b", "c", "d"}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted := map[string]int{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j, key := range keys {
+				results, err := Default.UpsertRows(0, 0, []map[ColumnIdType]interface{}{{0: key, count: float64(i*10 + j)}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if results[0].Inserted {
+					mu.Lock()
+					inserted[key]++
+					mu.Unlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if inserted[key] != 1 {
+			t.Fatalf("expected %s to be inserted once, but returned %d", key, inserted[key])
+		}
+	}
+	if rows := Default.Store.Tables[0].Rows; len(rows) != len(keys) {
+		t.Fatalf("expected a row per key, but returned %+v", rows)
+	}
+}
+
+func TestUpsertInTx(t *testing.T) {
+	count := configAccounts(t, "a")
+	m := NewTxManager(Default, time.Minute)
+	tx := m.Begin()
+
+	results, err := tx.UpsertRows(0, 0, []map[ColumnIdType]interface{}{
+		{0: "a", count: 1},
+		{0: "b", count: 2},
+		{0: "b", count: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[1].Inserted || results[0].Inserted || results[2].Inserted || results[2].Id != results[1].Id {
+		t.Fatalf("expected a to be updated and b inserted then updated, but returned %+v", results)
+	}
+	if row, _ := Default.GetRowById(0, 0); row.Columns[count] != nil {
+		t.Fatalf("expected an uncommitted update not to be visible, but returned %+v", row)
+	}
+
+	// the key is inserted meanwhile, the commit would repeat it
+	b, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uerr *UniqueError
+	if err := m.Commit(tx.Id); !errors.As(err, &uerr) {
+		t.Fatalf("expected the commit to fail on b, but returned %v", err)
+	}
+
+	tx = m.Begin()
+	if _, err := tx.UpsertRows(0, 0, []map[ColumnIdType]interface{}{{0: "b", count: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Commit(tx.Id); err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := Default.GetRowById(0, b); row.Columns[count] != 4.0 {
+		t.Fatalf("expected b to be updated, but returned %+v", row)
+	}
+
+	// the second update of an existing key keeps what the first one set
+	tx = m.Begin()
+	if _, err := tx.UpsertRows(0, 0, []map[ColumnIdType]interface{}{{0: "a", count: 5}, {0: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	tx.ReadTable(0, func(rows []Row[ColumnIdType], _ []TableColumn) error {
+		if rows[0].Columns[count] != 5.0 {
+			t.Fatalf("expected: count 5 in the transaction, but returned %+v", rows[0])
+		}
+		return nil
+	})
+	if err := m.Commit(tx.Id); err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := Default.GetRowById(0, 0); row.Columns[count] != 5.0 {
+		t.Fatalf("expected: count 5, but returned %+v", row)
+	}
+}
@@ -4,18 +4,34 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 )
 
-const DATA_FILE_NAME = ".store/data.bin"
-const METADATA_FILE_PATH = ".store/metadata.bin"
-
 var ResponseStrings = map[string]string{
 	"T1": "Table with this id not found",
+	"T2": "Table with this name already exists",
+	"T3": "Table name must not be empty",
+	"T4": "No more tables can be created",
+	"T5": "Table with this name not found",
 	"C1": "This column type is not allowed",
 	"C2": "Column with this name was not found",
+	"C3": "Column with this name already exists",
+	"V1": "Values don't match the table schema",
+	"I1": "Columns already have this index",
+	"I2": "Columns have no such index",
+	"I3": "This index kind is not allowed",
+	"I4": "Index is not allowed",
+	"U1": "Row with the same values of unique columns already exists",
+	"U2": "Key column must be unique",
+	"U3": "Row has no value of the key column",
+	"P1": "Table has no primary key",
+	"P2": "Table already has a primary key",
+	"P3": "Primary key column must not be optional",
+	"P4": "Primary key column can only be added to a table without rows",
+	"X1": "Transaction with this id not found",
+	"X2": "Transaction was aborted",
 	"R0": "Row with id %d has been found",
 	"R1": "Row with this id was not found",
 	"R2": "Row with id %d has been deleted",
@@ -36,14 +52,6 @@ func EncodeJson[T Row[string] | TableColumn | []Row[string]](obj T) (string, err
 	return string(out), err
 }
 
-func CreateFile(name string) *os.File {
-	f, err := os.Create(name)
-	if err != nil {
-		log.Println("Couldn't open file")
-	}
-	return f
-}
-
 func WriteFile(file io.Writer, binData any) error {
 	enc := gob.NewEncoder(file)
 	if err := enc.Encode(binData); err != nil {
@@ -53,59 +61,101 @@ func WriteFile(file io.Writer, binData any) error {
 }
 
 func ReadConfigFile[T []Table | []TableMetaData](name string) (T, error) {
+	var content T
 	f, err := os.Open(name)
 	if err != nil {
-		return *new(T), err
+		return content, err
 	}
 	defer f.Close()
 
 	dec := gob.NewDecoder(f)
-	var content *T
 	if err := dec.Decode(&content); err != nil {
-		return *content, err
+		return content, err
 	}
 
-	return *content, nil
+	return content, nil
 }
 
-func SyncDBFiles() {
+// writeFileAtomic replaces the file so a reader either sees its old or new
+// content in full, never a partially written one.
+func writeFileAtomic(name string, data []byte) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
 
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(dir)
 }
 
-func Dump() {
-	df := CreateFile("data.bin")
-	mf := CreateFile("metadata.bin")
-	defer df.Close()
-	defer mf.Close()
-
-	err := WriteFile(df, Store.Tables)
+func syncDir(name string) error {
+	dir, err := os.Open(name)
 	if err != nil {
-		log.Println("Write data failed")
-	}
-	err = WriteFile(mf, Store.TablesMetaData)
-	if err != nil {
-		log.Println("Write metadata failed")
+		return err
 	}
+	defer dir.Close()
+	return dir.Sync()
 }
 
-func Load() (bool, DatabaseStore) {
-	data, err := ReadConfigFile[[]Table]("data.bin")
-	if err != nil {
-		log.Println(err)
-		return false, DatabaseStore{}
+func (db *DB) Dump() error {
+	_, err := db.TakeSnapshot()
+	return err
+}
+
+// Load reads the latest snapshot, an error wrapping fs.ErrNotExist means
+// the store has never been dumped.
+func (db *DB) Load() (Snapshot, error) {
+	if db.Disk == nil {
+		return Snapshot{}, ErrNoStorage
 	}
-	metadata, err := ReadConfigFile[[]TableMetaData]("metadata.bin")
+
+	snap, err := readSnapshotFile(db.Disk)
 	if err != nil {
-		log.Println(err)
-		return false, DatabaseStore{}
+		return Snapshot{}, err
 	}
 
-	return true, DatabaseStore{
-		Tables:         data,
-		TablesMetaData: metadata,
+	if info, err := os.Stat(db.Disk.SnapshotPath()); err == nil {
+		db.setLastSnapshot(SnapshotInfo{
+			LSN:     snap.LSN,
+			TakenAt: info.ModTime(),
+			Size:    info.Size(),
+		})
 	}
+
+	return snap, nil
 }
 
-func Config(configData DatabaseStore) {
-	Store = configData
+func (db *DB) Config(configData DatabaseStore) {
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	db.Store = configData
+	for i := range db.Store.Tables {
+		db.Store.Tables[i].init()
+	}
+	for i := range db.Store.TablesMetaData {
+		db.Store.TablesMetaData[i].Id = TableIdType(i)
+		if i < len(db.Store.Tables) {
+			db.Store.Tables[i].buildIndexes(db.Store.TablesMetaData[i].Indexes)
+		}
+	}
 }
@@ -0,0 +1,236 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists every value of a write that doesn't fit the schema.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		reasons[i] = fmt.Sprintf("%s: %s", f.Field, f.Reason)
+	}
+	return fmt.Sprintf("%s (%s)", ResponseStrings["V1"], strings.Join(reasons, "; "))
+}
+
+func (e *ValidationError) add(field, reason string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{field, fmt.Sprintf(reason, args...)})
+}
+
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	sort.Slice(e.Fields, func(i, j int) bool { return e.Fields[i].Field < e.Fields[j].Field })
+	return e
+}
+
+// PrepareColumns maps column names of a request to ids and validates the
+// values. With partial set only the given columns are checked (updates),
+// otherwise every required column must be present (inserts).
+func (db *DB) PrepareColumns(tid TableIdType, values map[string]interface{}, partial bool) (map[ColumnIdType]interface{}, error) {
+	db.catalogLock.RLock()
+	defer db.catalogLock.RUnlock()
+
+	if !db.tableExists(tid) {
+		return nil, fmt.Errorf(ResponseStrings["T1"])
+	}
+
+	return prepareColumns(db.Store.TablesMetaData[tid].Columns, values, partial)
+}
+
+func prepareColumns(columns []TableColumn, values map[string]interface{}, partial bool) (map[ColumnIdType]interface{}, error) {
+	verr := &ValidationError{}
+	cols := make(map[ColumnIdType]interface{}, len(values))
+	for name, val := range values {
+		cid, err := findColumn(columns, name)
+		if err != nil {
+			verr.add(name, "unknown column")
+			continue
+		}
+		cols[cid] = val
+	}
+
+	cols = checkColumns(columns, cols, partial, verr)
+	return cols, verr.orNil()
+}
+
+// validateRow checks a whole row before it is inserted and returns its
+// values converted to the stored representation.
+func validateRow(columns []TableColumn, cols map[ColumnIdType]interface{}) (map[ColumnIdType]interface{}, error) {
+	verr := &ValidationError{}
+	cols = checkColumns(columns, cols, false, verr)
+	return cols, verr.orNil()
+}
+
+// validateDiff checks the changed values of an update, a nil value clears an
+// optional column.
+func validateDiff(columns []TableColumn, diff map[ColumnIdType]interface{}) (map[ColumnIdType]interface{}, error) {
+	verr := &ValidationError{}
+	diff = checkColumns(columns, diff, true, verr)
+	return diff, verr.orNil()
+}
+
+func checkColumns(columns []TableColumn, values map[ColumnIdType]interface{}, partial bool, verr *ValidationError) map[ColumnIdType]interface{} {
+	out := make(map[ColumnIdType]interface{}, len(values))
+	for cid, val := range values {
+		if int(cid) >= len(columns) {
+			verr.add(fmt.Sprint(cid), "unknown column")
+			continue
+		}
+		col := columns[cid]
+
+		if val == nil {
+			if !col.IsOptional {
+				verr.add(col.Name, "must not be null")
+			} else if partial {
+				out[cid] = nil
+			}
+			continue
+		}
+
+		converted, err := ConvertValue(val, col.Type)
+		if err != nil {
+			verr.add(col.Name, err.Error())
+			continue
+		}
+		out[cid] = converted
+	}
+
+	if !partial {
+		for _, col := range columns {
+			if _, ok := values[col.Id]; !ok && !col.IsOptional {
+				verr.add(col.Name, "is required")
+			}
+		}
+	}
+	return out
+}
+
+// ConvertValue turns a decoded value into the representation stored for
+// the column type: float64 for numbers, string and bool.
+func ConvertValue(val interface{}, colType uint8) (interface{}, error) {
+	switch colType {
+	case NumberColumn:
+		var num float64
+		switch v := val.(type) {
+		case float64:
+			num = v
+		case float32:
+			num = float64(v)
+		case int:
+			num = float64(v)
+		case int8:
+			num = float64(v)
+		case int16:
+			num = float64(v)
+		case int32:
+			num = float64(v)
+		case int64:
+			num = float64(v)
+		case uint:
+			num = float64(v)
+		case uint8:
+			num = float64(v)
+		case uint16:
+			num = float64(v)
+		case uint32:
+			num = float64(v)
+		case uint64:
+			num = float64(v)
+		default:
+			return nil, fmt.Errorf("expected number, got %s", typeName(val))
+		}
+		if math.IsNaN(num) || math.IsInf(num, 0) {
+			return nil, fmt.Errorf("must be a finite number")
+		}
+		return num, nil
+	case StringColumn:
+		if v, ok := val.(string); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected string, got %s", typeName(val))
+	case BoolColumn:
+		if v, ok := val.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected bool, got %s", typeName(val))
+	}
+	return nil, fmt.Errorf(ResponseStrings["C1"])
+}
+
+func typeName(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return ColumnsTypeEnum[StringColumn]
+	case bool:
+		return ColumnsTypeEnum[BoolColumn]
+	case float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return ColumnsTypeEnum[NumberColumn]
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+// CompareValues orders values of the same column, missing values first.
+// Values of different types are ordered by type rather than compared.
+func CompareValues(a, b any) int {
+	if ra, rb := valueRank(a), valueRank(b); ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		b := b.(bool)
+		if a == b {
+			return 0
+		} else if !a {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func valueRank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func configSchema() {
+	Default.Config(DatabaseStore{
+		Tables: []Table{{}},
+		TablesMetaData: []TableMetaData{{Columns: []TableColumn{
+			{Id: 0, Name: "name", Type: StringColumn},
+			{Id: 1, Name: "age", Type: NumberColumn},
+			{Id: 2, Name: "admin", Type: BoolColumn, IsOptional: true},
+		}}},
+	})
+}
+
+func fieldErrors(t *testing.T, err error) []FieldError {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, but returned %v", err)
+	}
+	return verr.Fields
+}
+
+func TestPrepareColumnsInsert(t *testing.T) {
+	configSchema()
+	cols, err := Default.PrepareColumns(0, map[string]interface{}{"name": "none", "age": 42}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[ColumnIdType]interface{}{0: "none", 1: 42.0}
+	if !reflect.DeepEqual(cols, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, cols)
+	}
+}
+
+func TestPrepareColumnsErrors(t *testing.T) {
+	configSchema()
+	_, err := Default.PrepareColumns(0, map[string]interface{}{
+		"name":  42.0,
+		"admin": "yes",
+		"email": "a@b",
+	}, false)
+	expected := []FieldError{
+		{"admin", "expected bool, got string"},
+		{"age", "is required"},
+		{"email", "unknown column"},
+		{"name", "expected string, got number"},
+	}
+	if fields := fieldErrors(t, err); !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, fields)
+	}
+}
+
+func TestPrepareColumnsNull(t *testing.T) {
+	configSchema()
+	_, err := Default.PrepareColumns(0, map[string]interface{}{"age": nil}, true)
+	expected := []FieldError{{"age", "must not be null"}}
+	if fields := fieldErrors(t, err); !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, fields)
+	}
+
+	diff, err := Default.PrepareColumns(0, map[string]interface{}{"admin": nil}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, ok := diff[2]; !ok || val != nil {
+		t.Fatalf("expected optional column to be cleared, but returned %+v", diff)
+	}
+}
+
+func TestUpdateRowRejectsWrongType(t *testing.T) {
+	configSchema()
+	rid, err := Default.AddNewRow(0, map[ColumnIdType]interface{}{0: "none", 1: 1, 2: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Default.UpdateRow(0, rid, map[ColumnIdType]interface{}{1: "old"}); err == nil {
+		t.Fatal("expected a string not to be stored in a number column")
+	}
+	if err := Default.UpdateRow(0, rid, map[ColumnIdType]interface{}{2: nil}); err != nil {
+		t.Fatal(err)
+	}
+	row, _ := Default.GetRowById(0, rid)
+	if _, ok := row.Columns[2]; ok || row.Columns[1] != 1.0 {
+		t.Fatalf("unexpected row %+v", row)
+	}
+}
@@ -0,0 +1,364 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// a log is split into segments named after the LSN of their first record
+const WAL_SEGMENT_NAME = "wal-%020d.log"
+
+// every record is framed as | length uint32 | crc32 uint32 | gob payload |
+const logHeaderSize = 8
+const maxLogRecordSize = 64 << 20
+
+type LogOperation uint8
+
+const (
+	LogInsertRow LogOperation = iota
+	LogUpdateRow
+	LogDeleteRow
+	LogNewColumn
+	LogNewTable
+	LogRenameTable
+	LogDropTable
+	LogUpdateRows
+	LogDeleteRows
+	LogCommit
+	LogNewIndex
+	LogDropIndex
+)
+
+type LogRecord struct {
+	LSN      uint64
+	Op       LogOperation
+	Table    TableIdType
+	Row      RowIdType
+	Rows     []RowIdType
+	Column   ColumnIdType
+	Columns  map[ColumnIdType]interface{}
+	Name     string
+	Type     uint8
+	Optional bool
+	Unique   bool           // of a new column or index
+	Primary  bool           // a new column is the primary key
+	Keys     []ColumnIdType // columns of an index
+	Batch    []LogRecord    // operations of a committed transaction
+}
+
+// logFile is what the log needs of a segment, an *os.File.
+type logFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+type WriteAheadLog struct {
+	mu       sync.Mutex
+	dir      string
+	segments []uint64 // first LSN of every segment in ascending order
+	file     logFile  // the last segment, the only one being appended to
+	size     int64
+	lsn      uint64
+}
+
+var ErrTornRecord = errors.New("torn log record")
+
+func OpenLog(dir string) (*WriteAheadLog, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &WriteAheadLog{dir: dir}
+	for _, name := range names {
+		var start uint64
+		if _, err := fmt.Sscanf(filepath.Base(name), WAL_SEGMENT_NAME, &start); err != nil {
+			continue
+		}
+		l.segments = append(l.segments, start)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	return l, nil
+}
+
+func (l *WriteAheadLog) segmentPath(start uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf(WAL_SEGMENT_NAME, start))
+}
+
+// Replay feeds every intact record newer than `after` to apply, in order.
+// A torn tail of the last segment (e.g. after a crash mid-write) is cut off
+// so new records are appended right after the last valid one.
+func (l *WriteAheadLog) Replay(after uint64, apply func(LogRecord) error) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lsn = after
+	count := 0
+	for i, start := range l.segments {
+		isLast := i == len(l.segments)-1
+
+		f, err := os.OpenFile(l.segmentPath(start), os.O_RDWR, 0644)
+		if err != nil {
+			return count, err
+		}
+
+		var offset int64
+		for {
+			rec, size, err := readLogRecord(f)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if !isLast {
+					f.Close()
+					return count, fmt.Errorf("log segment %d is corrupted at offset %d: %w", start, offset, err)
+				}
+				log.Printf("Log is truncated at offset %d: %s\n", offset, err)
+				break
+			}
+			offset += size
+			if rec.LSN <= l.lsn {
+				continue
+			}
+			if err := apply(rec); err != nil {
+				f.Close()
+				return count, fmt.Errorf("replay of record %d failed: %w", rec.LSN, err)
+			}
+			l.lsn = rec.LSN
+			count++
+		}
+
+		if !isLast {
+			f.Close()
+			continue
+		}
+		if err := f.Truncate(offset); err != nil {
+			f.Close()
+			return count, err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return count, err
+		}
+		l.file, l.size = f, offset
+	}
+
+	if l.file == nil {
+		if err := l.createSegment(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func readLogRecord(r io.Reader) (LogRecord, int64, error) {
+	var rec LogRecord
+	header := make([]byte, logHeaderSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF && n == 0 {
+			return rec, 0, io.EOF
+		}
+		return rec, 0, ErrTornRecord
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	if length > maxLogRecordSize {
+		return rec, 0, ErrTornRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, 0, ErrTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return rec, 0, ErrTornRecord
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return rec, 0, err
+	}
+	return rec, int64(logHeaderSize + length), nil
+}
+
+func (l *WriteAheadLog) createSegment() error {
+	start := l.lsn + 1
+	f, err := os.OpenFile(l.segmentPath(start), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		f.Close()
+		return err
+	}
+	l.segments = append(l.segments, start)
+	l.file, l.size = f, 0
+	return nil
+}
+
+// Append durably writes the record and returns once it has reached the disk.
+func (l *WriteAheadLog) Append(rec LogRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.LSN = l.lsn + 1
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(rec); err != nil {
+		return err
+	}
+
+	frame := make([]byte, logHeaderSize, logHeaderSize+payload.Len())
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	frame = append(frame, payload.Bytes()...)
+
+	if _, err := l.file.Write(frame); err != nil {
+		// don't leave a partial frame in front of the next record
+		l.discard()
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		// the record failed, it must not be replayed if it reached the disk
+		l.discard()
+		return err
+	}
+
+	l.size += int64(len(frame))
+	l.lsn = rec.LSN
+	return nil
+}
+
+// discard cuts what was written after the last appended record.
+func (l *WriteAheadLog) discard() {
+	l.file.Truncate(l.size)
+	l.file.Seek(l.size, io.SeekStart)
+}
+
+// LSN returns the sequence number of the last appended record.
+func (l *WriteAheadLog) LSN() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lsn
+}
+
+// Rotate starts a new segment, following records are appended to it.
+func (l *WriteAheadLog) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size == 0 {
+		return nil
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	return l.createSegment()
+}
+
+// Truncate removes the segments whose records all have LSN <= upTo.
+// The segment being appended to is always kept.
+func (l *WriteAheadLog) Truncate(upTo uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := 0
+	for kept < len(l.segments)-1 && l.segments[kept+1]-1 <= upTo {
+		if err := os.Remove(l.segmentPath(l.segments[kept])); err != nil && !os.IsNotExist(err) {
+			l.segments = l.segments[kept:]
+			return err
+		}
+		kept++
+	}
+	l.segments = l.segments[kept:]
+	return nil
+}
+
+func (l *WriteAheadLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func (db *DB) writeLog(rec LogRecord) error {
+	if db.Journal == nil {
+		return nil
+	}
+	if err := db.Journal.Append(rec); err != nil {
+		return err
+	}
+	if db.Snapshots != nil {
+		db.Snapshots.notify()
+	}
+	return nil
+}
+
+// ApplyLogRecord re-executes a logged mutation against the store.
+func (db *DB) ApplyLogRecord(rec LogRecord) error {
+	switch rec.Op {
+	case LogNewTable:
+		tid, err := db.CreateTable(rec.Name)
+		if err == nil && tid != rec.Table {
+			err = fmt.Errorf("table %s was created with id %d instead of %d", rec.Name, tid, rec.Table)
+		}
+		return err
+	case LogRenameTable:
+		return db.RenameTable(rec.Table, rec.Name)
+	case LogDropTable:
+		return db.DropTable(rec.Table)
+	}
+
+	db.catalogLock.Lock()
+	defer db.catalogLock.Unlock()
+
+	batch := []LogRecord{rec}
+	if rec.Op == LogCommit {
+		batch = rec.Batch
+	}
+	_, _, err := db.applyBatch(batch)
+	return err
+}
+
+// applyBatch applies all the records or none of them. It returns an undo of
+// the whole batch and the touched tables. The caller holds catalogLock exclusively.
+func (db *DB) applyBatch(batch []LogRecord) (func(), []TableIdType, error) {
+	var tables []TableIdType
+	undos := make([]func(), 0, len(batch))
+	undoAll := func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+
+	for i := range batch {
+		rec := &batch[i]
+		if rec.Op == LogNewColumn && db.tableExists(rec.Table) && rec.Column == 0 {
+			// written before column ids were logged, they are always appended
+			rec.Column = ColumnIdType(len(db.Store.TablesMetaData[rec.Table].Columns))
+		}
+		undo, err := db.applyRecord(rec)
+		if err != nil {
+			undoAll()
+			return nil, nil, err
+		}
+		undos = append(undos, undo)
+		tables = append(tables, rec.Table)
+	}
+	return undoAll, tables, nil
+}
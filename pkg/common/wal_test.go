@@ -0,0 +1,149 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func openTestLog(t *testing.T, dir string) *WriteAheadLog {
+	wal, err := OpenLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	return wal
+}
+
+func replayAll(t *testing.T, wal *WriteAheadLog, after uint64) []LogRecord {
+	var replayed []LogRecord
+	if _, err := wal.Replay(after, func(rec LogRecord) error {
+		replayed = append(replayed, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return replayed
+}
+
+func TestLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	records := []LogRecord{
+		{Op: LogNewColumn, Name: "name", Type: 1},
+		{Op: LogInsertRow, Row: 0, Columns: map[ColumnIdType]interface{}{0: "none"}},
+		{Op: LogDeleteRow, Row: 0},
+	}
+	for _, rec := range records {
+		if err := wal.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wal.Close()
+
+	replayed := replayAll(t, openTestLog(t, dir), 0)
+	if len(replayed) != len(records) {
+		t.Fatalf("expected %d records, but replayed %d", len(records), len(replayed))
+	}
+	for i, rec := range replayed {
+		records[i].LSN = uint64(i + 1)
+		if !reflect.DeepEqual(rec, records[i]) {
+			t.Fatalf("expected: %+v, but returned %+v", records[i], rec)
+		}
+	}
+}
+
+// unsyncedFile is a segment whose writes reach it but can't be synced.
+type unsyncedFile struct {
+	logFile
+}
+
+func (unsyncedFile) Sync() error {
+	return errors.New("sync failed")
+}
+
+func TestLogFailedSync(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	if err := wal.Append(LogRecord{Op: LogDeleteRow, Row: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := wal.file
+	wal.file = unsyncedFile{file}
+	if err := wal.Append(LogRecord{Op: LogDeleteRow, Row: 2}); err == nil {
+		t.Fatal("expected the append to fail")
+	}
+	wal.file = file
+	if err := wal.Append(LogRecord{Op: LogDeleteRow, Row: 3}); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	replayed := replayAll(t, openTestLog(t, dir), 0)
+	expected := []LogRecord{{LSN: 1, Op: LogDeleteRow, Row: 1}, {LSN: 2, Op: LogDeleteRow, Row: 3}}
+	if !reflect.DeepEqual(replayed, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, replayed)
+	}
+}
+
+func TestLogReplayTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	if err := wal.Append(LogRecord{Op: LogInsertRow, Columns: map[ColumnIdType]interface{}{0: 1.0}}); err != nil {
+		t.Fatal(err)
+	}
+	path := wal.segmentPath(1)
+	info, _ := os.Stat(path)
+	validSize := info.Size()
+
+	// half-written frame left by a crash
+	wal.file.Write([]byte{42, 0, 0, 0, 1, 2})
+	wal.Close()
+
+	reopened := openTestLog(t, dir)
+	if n := len(replayAll(t, reopened, 0)); n != 1 {
+		t.Fatalf("expected 1 record, but replayed %d", n)
+	}
+	info, _ = os.Stat(path)
+	if info.Size() != validSize {
+		t.Fatalf("expected log to be truncated to %d bytes, but it is %d", validSize, info.Size())
+	}
+
+	if err := reopened.Append(LogRecord{Op: LogDeleteRow}); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+
+	if n := len(replayAll(t, openTestLog(t, dir), 0)); n != 2 {
+		t.Fatalf("expected 2 records after append, but replayed %d", n)
+	}
+}
+
+func TestLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestLog(t, dir)
+	replayAll(t, wal, 0)
+	wal.Append(LogRecord{Op: LogInsertRow})
+	wal.Append(LogRecord{Op: LogInsertRow})
+	if err := wal.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	wal.Append(LogRecord{Op: LogDeleteRow})
+	if err := wal.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wal.segmentPath(1)); !os.IsNotExist(err) {
+		t.Fatalf("expected the first segment to be removed")
+	}
+	wal.Close()
+
+	replayed := replayAll(t, openTestLog(t, dir), 2)
+	if len(replayed) != 1 || replayed[0].LSN != 3 || replayed[0].Op != LogDeleteRow {
+		t.Fatalf("expected only the delete record to be replayed, but returned %+v", replayed)
+	}
+}
@@ -0,0 +1,349 @@
+// Package curiodb embeds the database into a Go program, no server is needed.
+//
+//	db, err := curiodb.Open("data", curiodb.DefaultOptions())
+//	users, err := db.CreateTable("users")
+//	err = users.AddColumn("name", curiodb.String, false)
+//	id, err := users.Insert(map[string]any{"name": "alice"})
+//	rows, err := users.Find(curiodb.Filter{"name": {"=alice"}})
+package curiodb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+)
+
+type Options = common.Options
+type RowId = common.RowIdType
+type Filter = common.FilterType
+type Row = common.Row[string]
+type Column = common.TableColumn
+type Aggregation = common.Aggregation
+type AggregateResult = engine.AggregateResult
+type UpsertResult = common.UpsertResult
+type TransferOptions = engine.TransferOptions
+type ImportResult = engine.ImportResult
+
+type ColumnType uint8
+
+const (
+	Number = ColumnType(common.NumberColumn)
+	String = ColumnType(common.StringColumn)
+	Bool   = ColumnType(common.BoolColumn)
+)
+
+type IndexKind uint8
+
+const (
+	Hash    = IndexKind(common.HashIndex)
+	Ordered = IndexKind(common.OrderedIndex)
+)
+
+func DefaultOptions() Options {
+	return common.DefaultOptions()
+}
+
+// DB is an open database. It is safe for concurrent use.
+type DB struct {
+	db *common.DB
+}
+
+// Open opens the database kept in dir, it is created if it doesn't exist.
+// A directory can be opened by one DB at a time.
+func Open(dir string, opts Options) (*DB, error) {
+	db, err := common.Open(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db}, nil
+}
+
+// Close persists the database and releases its directory.
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+// Snapshot dumps the database right away instead of waiting for the
+// periodic snapshot.
+func (db *DB) Snapshot() error {
+	_, err := db.db.TakeSnapshot()
+	return err
+}
+
+func (db *DB) CreateTable(name string) (*Table, error) {
+	tid, err := db.db.CreateTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Table{db.db, tid}, nil
+}
+
+func (db *DB) Table(name string) (*Table, error) {
+	tid, err := db.db.FindTableByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Table{db.db, tid}, nil
+}
+
+// Tables lists the names of all tables.
+func (db *DB) Tables() []string {
+	var names []string
+	for _, meta := range db.db.ListTables() {
+		names = append(names, meta.Name)
+	}
+	return names
+}
+
+func (db *DB) RenameTable(name, newName string) error {
+	tid, err := db.db.FindTableByName(name)
+	if err != nil {
+		return err
+	}
+	return db.db.RenameTable(tid, newName)
+}
+
+func (db *DB) DropTable(name string) error {
+	tid, err := db.db.FindTableByName(name)
+	if err != nil {
+		return err
+	}
+	return db.db.DropTable(tid)
+}
+
+// Table is a handle of a table, it stays valid when the table is renamed.
+type Table struct {
+	db *common.DB
+	id common.TableIdType
+}
+
+func (t *Table) Columns() ([]Column, error) {
+	var columns []Column
+	err := t.db.ReadTable(t.id, func(_ *common.Table, meta *common.TableMetaData) error {
+		columns = append(columns, meta.Columns...)
+		return nil
+	})
+	return columns, err
+}
+
+func (t *Table) AddColumn(name string, typ ColumnType, optional bool) error {
+	return t.addColumn(Column{Name: name, Type: uint8(typ), IsOptional: optional})
+}
+
+// AddUniqueColumn adds a column no two rows hold the same value of, rows
+// without a value don't count.
+func (t *Table) AddUniqueColumn(name string, typ ColumnType, optional bool) error {
+	return t.addColumn(Column{Name: name, Type: uint8(typ), IsOptional: optional, IsUnique: true})
+}
+
+// AddPrimaryKey adds the required unique column rows are found by with
+// GetByKey. The table must have no primary key and no rows yet.
+func (t *Table) AddPrimaryKey(name string, typ ColumnType) error {
+	return t.addColumn(Column{Name: name, Type: uint8(typ), IsUnique: true, IsPrimary: true})
+}
+
+func (t *Table) addColumn(col Column) error {
+	_, err := t.db.AddColumn(t.id, col)
+	return err
+}
+
+// CreateIndex keeps an index on the columns. Filters comparing a column
+// with a hash index by =, !, != or in look the rows up instead of scanning
+// them all. An ordered index serves ranges and prefixes on its columns and
+// = on the ones before, it may be on several columns.
+func (t *Table) CreateIndex(kind IndexKind, columns ...string) error {
+	index, err := t.index(kind, columns)
+	if err != nil {
+		return err
+	}
+	return t.db.CreateIndex(t.id, index)
+}
+
+// CreateUniqueIndex is CreateIndex for an index that also refuses rows with
+// the same values of its columns as another row, an ordered one makes the
+// combination of its columns unique.
+func (t *Table) CreateUniqueIndex(kind IndexKind, columns ...string) error {
+	index, err := t.index(kind, columns)
+	if err != nil {
+		return err
+	}
+	index.Unique = true
+	return t.db.CreateIndex(t.id, index)
+}
+
+func (t *Table) DropIndex(kind IndexKind, columns ...string) error {
+	index, err := t.index(kind, columns)
+	if err != nil {
+		return err
+	}
+	return t.db.DropIndex(t.id, index)
+}
+
+func (t *Table) index(kind IndexKind, columns []string) (common.TableIndex, error) {
+	index := common.TableIndex{Kind: uint8(kind)}
+	for _, name := range columns {
+		cid, err := t.db.FindColumnByName(t.id, name)
+		if err != nil {
+			return index, err
+		}
+		index.Columns = append(index.Columns, cid)
+	}
+	return index, nil
+}
+
+// Insert adds a row, values are keyed by column name. Any Go integer or
+// float fits a number column.
+func (t *Table) Insert(values map[string]any) (RowId, error) {
+	cols, err := t.db.PrepareColumns(t.id, values, false)
+	if err != nil {
+		return 0, err
+	}
+	return t.db.AddNewRow(t.id, cols)
+}
+
+// Upsert inserts each row whose value of the unique column on no row holds
+// yet and updates the row holding it otherwise, on is the primary key when
+// empty. All the rows are written or none of them.
+func (t *Table) Upsert(on string, rows ...map[string]any) ([]UpsertResult, error) {
+	var key common.ColumnIdType
+	if on == "" {
+		pk, err := t.db.PrimaryKey(t.id)
+		if err != nil {
+			return nil, err
+		}
+		key = pk.Id
+	} else {
+		cid, err := t.db.FindColumnByName(t.id, on)
+		if err != nil {
+			return nil, err
+		}
+		key = cid
+	}
+
+	prepared := make([]map[common.ColumnIdType]any, len(rows))
+	for i, values := range rows {
+		cols, err := t.db.PrepareColumns(t.id, values, true)
+		if err != nil {
+			return nil, err
+		}
+		prepared[i] = cols
+	}
+	return t.db.UpsertRows(t.id, key, prepared)
+}
+
+// InsertMany adds all the rows or none of them, with a single write to the
+// log.
+func (t *Table) InsertMany(rows ...map[string]any) ([]RowId, error) {
+	prepared := make([]map[common.ColumnIdType]any, len(rows))
+	for i, values := range rows {
+		cols, err := t.db.PrepareColumns(t.id, values, false)
+		if err != nil {
+			return nil, err
+		}
+		prepared[i] = cols
+	}
+	ids, errs, err := t.db.InsertRows(t.id, prepared, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// Export writes the rows of the table as a CSV, a JSON array or NDJSON.
+func (t *Table) Export(w io.Writer, opts TransferOptions) (int, error) {
+	return engine.ExportTable(t.db, t.id, w, opts)
+}
+
+// Import inserts the rows read from r, converting values to the column
+// types. The rows that can't be inserted are listed in the result.
+func (t *Table) Import(r io.Reader, opts TransferOptions) (ImportResult, error) {
+	return engine.ImportTable(t.db, t.id, r, opts)
+}
+
+func (t *Table) Get(id RowId) (Row, error) {
+	row, err := t.db.GetRowById(t.id, id)
+	if err != nil {
+		return Row{}, err
+	}
+	columns, err := t.Columns()
+	if err != nil {
+		return Row{}, err
+	}
+
+	named := Row{Id: row.Id, Columns: make(map[string]any, len(row.Columns))}
+	for cid, val := range row.Columns {
+		// the table may have been dropped and created again meanwhile
+		if int(cid) < len(columns) {
+			named.Columns[columns[cid].Name] = val
+		}
+	}
+	return named, nil
+}
+
+// GetByKey returns the row whose primary key is key.
+func (t *Table) GetByKey(key any) (Row, error) {
+	pk, err := t.db.PrimaryKey(t.id)
+	if err != nil {
+		return Row{}, err
+	}
+	operand, err := json.Marshal([]any{key})
+	if err != nil {
+		return Row{}, err
+	}
+	rows, err := t.Find(Filter{pk.Name: {"in" + string(operand)}})
+	if err != nil {
+		return Row{}, err
+	}
+	if len(rows) == 0 {
+		return Row{}, fmt.Errorf(common.ResponseStrings["R1"])
+	}
+	return rows[0], nil
+}
+
+// Find returns the rows matching the filter, the same filter as in the
+// `/row/get` request. An empty filter matches every row.
+func (t *Table) Find(filter Filter) ([]Row, error) {
+	return engine.SearchForRecords(t.db, t.id, filter)
+}
+
+// Update sets the values of all the rows matching the filter and returns
+// how many there were. A nil value clears an optional column.
+func (t *Table) Update(filter Filter, values map[string]any) (int, error) {
+	diff, err := t.db.PrepareColumns(t.id, values, true)
+	if err != nil {
+		return 0, err
+	}
+	ids, _, err := engine.UpdateInTx(t.db, nil, t.id, common.Where(filter), diff)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// Delete removes all the rows matching the filter and returns how many
+// there were.
+func (t *Table) Delete(filter Filter) (int, error) {
+	ids, _, err := engine.DeleteInTx(t.db, nil, t.id, common.Where(filter))
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// Aggregate computes the aggregates over the rows matching the filter, for
+// each group of rows with the same values in the group by columns. Having
+// filters the groups by the names of their results, it may be nil. A result
+// without a value, like the average of no values, matches no condition.
+func (t *Table) Aggregate(filter Filter, groupBy []string, having Filter, aggs ...Aggregation) (AggregateResult, error) {
+	data := common.AggregateData{Aggregates: aggs, GroupBy: groupBy, Having: common.Where(having)}
+	data.Filter = common.Where(filter)
+	return engine.Aggregate(t.db, nil, t.id, data)
+}
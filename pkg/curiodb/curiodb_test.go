@@ -0,0 +1,180 @@
+package curiodb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func openTestDB(t *testing.T, dir string) *DB {
+	db, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createUsers(t *testing.T, db *DB) *Table {
+	users, err := db.CreateTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.AddColumn("name", String, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.AddColumn("age", Number, true); err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestInsertFindUpdateDelete(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	users := createUsers(t, db)
+
+	for i, name := range []string{"alice", "bob", "carol"} {
+		if _, err := users.Insert(map[string]any{"name": name, "age": 20 + i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := users.Find(Filter{"age": {">20"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, but returned %+v", rows)
+	}
+
+	n, err := users.Update(Filter{"name": {"=bob"}}, map[string]any{"age": 30})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 updated row, but returned %d, %v", n, err)
+	}
+	row, err := users.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Columns["age"] != 30.0 {
+		t.Fatalf("expected age 30, but returned %+v", row)
+	}
+
+	n, err = users.Delete(Filter{"age": {"<21"}})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 deleted row, but returned %d, %v", n, err)
+	}
+	if _, err := users.Get(0); err == nil {
+		t.Fatal("expected the deleted row not to be found")
+	}
+
+	if _, err := users.Insert(map[string]any{"age": 1}); err == nil {
+		t.Fatal("expected a row without a name to be rejected")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	users := createUsers(t, db)
+	if _, err := users.Insert(map[string]any{"name": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir, Options{}); err == nil {
+		t.Fatal("expected the directory to be locked")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+	users, err := db.Table("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := users.Find(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Columns["name"] != "alice" {
+		t.Fatalf("expected the row to survive a reopen, but returned %+v", rows)
+	}
+}
+
+func TestIndependentInstances(t *testing.T) {
+	first := openTestDB(t, t.TempDir())
+	defer first.Close()
+	second := openTestDB(t, t.TempDir())
+	defer second.Close()
+
+	users := createUsers(t, first)
+	if _, err := users.Insert(map[string]any{"name": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := second.Table("users"); err == nil {
+		t.Fatal("expected a table of one instance not to exist in another")
+	}
+	if _, err := second.CreateTable("users"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	users := createUsers(t, db)
+
+	for i, name := range []string{"alice", "bob", "alice"} {
+		if _, err := users.Insert(map[string]any{"name": name, "age": 20 + i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := users.Aggregate(nil, []string{"name"}, Filter{"oldest": {">21"}},
+		Aggregation{Op: "count"}, Aggregation{Op: "max", Column: "age", As: "oldest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]any{{"name": "alice", "count": 2.0, "oldest": 22.0}}
+	if !reflect.DeepEqual(result.Rows, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, result.Rows)
+	}
+}
+
+func TestPrimaryKeyReopen(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	accounts, err := db.CreateTable("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.AddPrimaryKey("login", String); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.AddUniqueColumn("email", String, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accounts.Insert(map[string]any{"login": "al", "email": "al@x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+	accounts, err = db.Table("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := accounts.GetByKey("al")
+	if err != nil || row.Columns["email"] != "al@x" {
+		t.Fatalf("expected the row of al, but returned %+v, %v", row, err)
+	}
+	if _, err := accounts.GetByKey("bo"); err == nil {
+		t.Fatal("expected no row for bo")
+	}
+	if _, err := accounts.Insert(map[string]any{"login": "bo", "email": "al@x"}); err == nil {
+		t.Fatal("expected the email to stay unique after a reopen")
+	}
+}
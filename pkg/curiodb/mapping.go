@@ -0,0 +1,427 @@
+package curiodb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// Struct fields are mapped to columns with the `curio` tag:
+//
+//	type User struct {
+//		Id    curiodb.RowId `curio:"id"`
+//		Login string        `curio:"login,primary"`
+//		Name  string        `curio:"name"`
+//		Age   int           `curio:"age,type=number,optional"`
+//		Phone *string       `curio:"phone,unique"`
+//		Email *string       `curio:"email"`
+//		Notes string        `curio:"-"`
+//	}
+//
+// Without a name the field name is used, without a type it follows from the
+// Go type. Pointer fields are optional, nil is stored as null. Unique and
+// primary make the column unique or the primary key of the table. A field
+// named id holds the row id and is not a column. Unexported fields are
+// skipped.
+const TAG_NAME = "curio"
+
+// MappingError lists every field of a struct that doesn't fit the table.
+type MappingError struct {
+	Type   string
+	Fields []common.FieldError
+}
+
+func (e *MappingError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		reasons[i] = fmt.Sprintf("%s: %s", f.Field, f.Reason)
+	}
+	return fmt.Sprintf("%s doesn't match the table (%s)", e.Type, strings.Join(reasons, "; "))
+}
+
+func (e *MappingError) add(field, reason string, args ...any) {
+	e.Fields = append(e.Fields, common.FieldError{Field: field, Reason: fmt.Sprintf(reason, args...)})
+}
+
+func (e *MappingError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	sort.Slice(e.Fields, func(i, j int) bool { return e.Fields[i].Field < e.Fields[j].Field })
+	return e
+}
+
+type structField struct {
+	index    []int
+	name     string
+	colType  uint8
+	optional bool
+	unique   bool
+	primary  bool
+	pointer  bool
+}
+
+type structMapping struct {
+	typ    reflect.Type
+	id     []int // index of the row id field, nil if there is none
+	fields []structField
+}
+
+var mappings sync.Map // reflect.Type -> *structMapping
+
+func mappingOf[T any]() (*structMapping, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if m, ok := mappings.Load(typ); ok {
+		return m.(*structMapping), nil
+	}
+	m, err := newMapping(typ)
+	if err != nil {
+		return nil, err
+	}
+	mappings.Store(typ, m)
+	return m, nil
+}
+
+func newMapping(typ reflect.Type) (*structMapping, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", typ)
+	}
+
+	m := &structMapping{typ: typ}
+	merr := &MappingError{Type: typ.String()}
+	seen := map[string]bool{}
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get(TAG_NAME)
+		if tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		field := structField{index: f.Index, name: opts[0]}
+		if field.name == "" {
+			field.name = f.Name
+		}
+		if seen[field.name] {
+			merr.add(field.name, "is mapped by more than one field")
+			continue
+		}
+		seen[field.name] = true
+
+		if field.name == "id" {
+			if !isInteger(f.Type.Kind()) {
+				merr.add(field.name, "row id must be an integer, not %s", f.Type)
+				continue
+			}
+			m.id = f.Index
+			continue
+		}
+
+		goType := f.Type
+		if goType.Kind() == reflect.Pointer {
+			field.pointer, field.optional = true, true
+			goType = goType.Elem()
+		}
+		colType, ok := columnTypeOf(goType)
+
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == "optional":
+				field.optional = true
+			case opt == "unique":
+				field.unique = true
+			case opt == "primary":
+				field.primary = true
+			case strings.HasPrefix(opt, "type="):
+				typeName := strings.TrimPrefix(opt, "type=")
+				declared, err := common.ColumnTypeByName(typeName)
+				if err != nil {
+					merr.add(field.name, "unknown type %q", typeName)
+					continue
+				}
+				if ok && declared != colType {
+					merr.add(field.name, "%s can't be stored as %s", goType, typeName)
+				}
+				colType, ok = declared, true
+			default:
+				merr.add(field.name, "unknown option %q", opt)
+			}
+		}
+		if !ok {
+			merr.add(field.name, "%s can't be stored in a column", goType)
+			continue
+		}
+		field.colType = colType
+		m.fields = append(m.fields, field)
+	}
+	return m, merr.orNil()
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func columnTypeOf(typ reflect.Type) (uint8, bool) {
+	switch kind := typ.Kind(); {
+	case kind == reflect.String:
+		return common.StringColumn, true
+	case kind == reflect.Bool:
+		return common.BoolColumn, true
+	case kind == reflect.Float32 || kind == reflect.Float64 || isInteger(kind):
+		return common.NumberColumn, true
+	}
+	return 0, false
+}
+
+// check compares the struct with the columns of a table. With insert set
+// every required column must be in the struct too.
+func (m *structMapping) check(columns []Column, insert bool) error {
+	merr := &MappingError{Type: m.typ.String()}
+	mapped := map[string]bool{}
+	for _, field := range m.fields {
+		mapped[field.name] = true
+		col, ok := findColumn(columns, field.name)
+		if !ok {
+			merr.add(field.name, "no such column")
+			continue
+		}
+		if col.Type != field.colType {
+			merr.add(field.name, "is %s, but the column is %s",
+				common.ColumnsTypeEnum[field.colType], common.ColumnsTypeEnum[col.Type])
+		}
+		if field.optional && !col.IsOptional && insert {
+			merr.add(field.name, "may be null, but the column is required")
+		}
+	}
+	if insert {
+		for _, col := range columns {
+			if !col.IsOptional && !mapped[col.Name] {
+				merr.add(col.Name, "required column is not in the struct")
+			}
+		}
+	}
+	return merr.orNil()
+}
+
+func findColumn(columns []Column, name string) (Column, bool) {
+	for _, col := range columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// SchemaOf derives the columns of a table from the struct T.
+func SchemaOf[T any]() ([]Column, error) {
+	m, err := mappingOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]Column, len(m.fields))
+	for i, field := range m.fields {
+		columns[i] = Column{
+			Id:         common.ColumnIdType(i),
+			Name:       field.name,
+			Type:       field.colType,
+			IsOptional: field.optional,
+			IsUnique:   field.unique || field.primary,
+			IsPrimary:  field.primary,
+		}
+	}
+	return columns, nil
+}
+
+// CreateTableFor creates a table with a column for every field of T. If a
+// column can't be added the table is dropped again.
+func CreateTableFor[T any](db *DB, name string) (*Table, error) {
+	columns, err := SchemaOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	table, err := db.CreateTable(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range columns {
+		if err := table.addColumn(col); err != nil {
+			db.db.DropTable(table.id)
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// CheckSchema reports every field of T that doesn't fit the table.
+func CheckSchema[T any](t *Table) error {
+	m, err := mappingOf[T]()
+	if err != nil {
+		return err
+	}
+	columns, err := t.Columns()
+	if err != nil {
+		return err
+	}
+	return m.check(columns, true)
+}
+
+// InsertStruct adds a row with the fields of v and returns its id.
+func InsertStruct[T any](t *Table, v T) (RowId, error) {
+	m, err := mappingOf[T]()
+	if err != nil {
+		return 0, err
+	}
+	columns, err := t.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.check(columns, true); err != nil {
+		return 0, err
+	}
+	return t.Insert(m.values(reflect.ValueOf(v)))
+}
+
+func (m *structMapping) values(v reflect.Value) map[string]any {
+	values := make(map[string]any, len(m.fields))
+	for _, field := range m.fields {
+		fv := v.FieldByIndex(field.index)
+		if field.pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		switch kind := fv.Kind(); {
+		case kind == reflect.String:
+			values[field.name] = fv.String()
+		case kind == reflect.Bool:
+			values[field.name] = fv.Bool()
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			values[field.name] = fv.Float()
+		case fv.CanInt():
+			values[field.name] = float64(fv.Int())
+		case fv.CanUint():
+			values[field.name] = float64(fv.Uint())
+		}
+	}
+	return values
+}
+
+// FindAs returns the rows matching the filter decoded into T.
+func FindAs[T any](t *Table, filter Filter) ([]T, error) {
+	m, err := mappingOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	columns, err := t.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.check(columns, false); err != nil {
+		return nil, err
+	}
+	rows, err := t.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRows[T](m, rows)
+}
+
+// DecodeRows decodes rows, e.g. results of api.SearchForRecords, into T.
+// Columns without a field in T are ignored.
+func DecodeRows[T any](rows []Row) ([]T, error) {
+	m, err := mappingOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	return decodeRows[T](m, rows)
+}
+
+func decodeRows[T any](m *structMapping, rows []Row) ([]T, error) {
+	out := make([]T, len(rows))
+	for i, row := range rows {
+		v := reflect.ValueOf(&out[i]).Elem()
+		if m.id != nil {
+			idField := v.FieldByIndex(m.id)
+			if idField.CanUint() {
+				idField.SetUint(uint64(row.Id))
+			} else {
+				idField.SetInt(int64(row.Id))
+			}
+		}
+		merr := &MappingError{Type: m.typ.String()}
+		for _, field := range m.fields {
+			val, ok := row.Columns[field.name]
+			if !ok || val == nil {
+				continue
+			}
+			fv := v.FieldByIndex(field.index)
+			if field.pointer {
+				fv.Set(reflect.New(fv.Type().Elem()))
+				fv = fv.Elem()
+			}
+			if err := setValue(fv, val); err != nil {
+				merr.add(field.name, "row %d: %s", row.Id, err)
+			}
+		}
+		if err := merr.orNil(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func setValue(fv reflect.Value, val any) error {
+	switch v := val.(type) {
+	case string:
+		if fv.Kind() != reflect.String {
+			return fmt.Errorf("can't store string in %s", fv.Type())
+		}
+		fv.SetString(v)
+	case bool:
+		if fv.Kind() != reflect.Bool {
+			return fmt.Errorf("can't store bool in %s", fv.Type())
+		}
+		fv.SetBool(v)
+	case float64:
+		return setNumber(fv, v)
+	default:
+		return fmt.Errorf("can't store %T in %s", val, fv.Type())
+	}
+	return nil
+}
+
+func setNumber(fv reflect.Value, num float64) error {
+	switch {
+	case fv.CanFloat():
+		if fv.OverflowFloat(num) {
+			return fmt.Errorf("%v overflows %s", num, fv.Type())
+		}
+		fv.SetFloat(num)
+	case fv.CanInt():
+		if num != math.Trunc(num) || fv.OverflowInt(int64(num)) {
+			return fmt.Errorf("%v doesn't fit %s", num, fv.Type())
+		}
+		fv.SetInt(int64(num))
+	case fv.CanUint():
+		if num < 0 || num != math.Trunc(num) || fv.OverflowUint(uint64(num)) {
+			return fmt.Errorf("%v doesn't fit %s", num, fv.Type())
+		}
+		fv.SetUint(uint64(num))
+	default:
+		return fmt.Errorf("can't store number in %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package curiodb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type user struct {
+	Id    RowId   `curio:"id"`
+	Name  string  `curio:"name"`
+	Age   int     `curio:"age,optional"`
+	Email *string `curio:"email"`
+	Admin bool
+	Notes string `curio:"-"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	columns, err := SchemaOf[user]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Column{
+		{Id: 0, Name: "name", Type: uint8(String)},
+		{Id: 1, Name: "age", Type: uint8(Number), IsOptional: true},
+		{Id: 2, Name: "email", Type: uint8(String), IsOptional: true},
+		{Id: 3, Name: "Admin", Type: uint8(Bool)},
+	}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, columns)
+	}
+}
+
+func TestSchemaOfBadTags(t *testing.T) {
+	type bad struct {
+		Name  int      `curio:"name,type=string"`
+		Tags  []string `curio:"tags"`
+		Count int      `curio:"count,sorted"`
+	}
+	_, err := SchemaOf[bad]()
+	var merr *MappingError
+	if !errors.As(err, &merr) || len(merr.Fields) != 3 {
+		t.Fatalf("expected 3 bad fields, but returned %v", err)
+	}
+}
+
+func TestInsertAndFindStructs(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	users, err := CreateTableFor[user](db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := "bob@example.com"
+	for _, u := range []user{
+		{Name: "alice", Age: 30, Notes: "not stored"},
+		{Name: "bob", Email: &email, Admin: true},
+	} {
+		if _, err := InsertStruct(users, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := FindAs[user](users, Filter{"name": {"=bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []user{{Id: 1, Name: "bob", Email: &email, Admin: true}}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, found)
+	}
+}
+
+func TestCreateTableForFails(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	before := db.Tables()
+
+	type twoKeys struct {
+		Login string `curio:"login,primary"`
+		Email string `curio:"email,primary"`
+	}
+	if _, err := CreateTableFor[twoKeys](db, "accounts"); err == nil {
+		t.Fatal("expected an error for two primary keys")
+	}
+	if tables := db.Tables(); !reflect.DeepEqual(tables, before) {
+		t.Fatalf("expected: %+v, but returned %+v", before, tables)
+	}
+	if _, err := CreateTableFor[user](db, "accounts"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStructDoesNotMatchTable(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	users := createUsers(t, db)
+
+	type wrong struct {
+		Name  bool   `curio:"name"`
+		Email string `curio:"email"`
+	}
+	err := CheckSchema[wrong](users)
+	var merr *MappingError
+	if !errors.As(err, &merr) {
+		t.Fatalf("expected a mapping error, but returned %v", err)
+	}
+	if len(merr.Fields) != 2 || merr.Fields[0].Field != "email" || merr.Fields[1].Field != "name" {
+		t.Fatalf("expected email and name to be reported, but returned %+v", merr.Fields)
+	}
+	if _, err := InsertStruct(users, wrong{}); !errors.As(err, &merr) {
+		t.Fatalf("expected the insert to be rejected, but returned %v", err)
+	}
+}
+
+func TestDecodeRows(t *testing.T) {
+	type small struct {
+		Age uint8 `curio:"age"`
+	}
+	rows, err := DecodeRows[small]([]Row{{Id: 0, Columns: map[string]any{"age": 42.0, "name": "x"}}})
+	if err != nil || rows[0].Age != 42 {
+		t.Fatalf("expected age 42, but returned %+v, %v", rows, err)
+	}
+	if _, err := DecodeRows[small]([]Row{{Id: 0, Columns: map[string]any{"age": 300.0}}}); err == nil {
+		t.Fatal("expected an overflow to be reported")
+	}
+}
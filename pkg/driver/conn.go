@@ -0,0 +1,195 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+var ErrTxActive = errors.New("a transaction is already active on this connection")
+
+type conn struct {
+	backend backend
+	tx      common.TxIdType
+}
+
+func (c *conn) Prepare(src string) (driver.Stmt, error) {
+	q, err := query.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{c, q}, nil
+}
+
+func (c *conn) Close() error {
+	if c.tx != 0 {
+		c.backend.Rollback(c.tx)
+		c.tx = 0
+	}
+	return c.backend.close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	if c.tx != 0 {
+		return nil, ErrTxActive
+	}
+	id, err := c.backend.Begin()
+	if err != nil {
+		return nil, err
+	}
+	c.tx = id
+	return &tx{c}, nil
+}
+
+type tx struct {
+	c *conn
+}
+
+func (t *tx) Commit() error {
+	id := t.c.tx
+	t.c.tx = 0
+	return t.c.backend.Commit(id)
+}
+
+func (t *tx) Rollback() error {
+	id := t.c.tx
+	t.c.tx = 0
+	return t.c.backend.Rollback(id)
+}
+
+type stmt struct {
+	c *conn
+	q *query.Query
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.q.Params
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, ok := s.q.Statement.(*query.Select); ok {
+		return nil, errors.New("use Query to run a SELECT")
+	}
+	res, err := s.execute(args)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.q.Statement.(*query.CreateTable); ok {
+		return driver.ResultNoRows, nil
+	}
+	if _, ok := s.q.Statement.(*query.AddColumn); ok {
+		return driver.ResultNoRows, nil
+	}
+	return result{id: int64(res.LastId), rows: int64(res.Count)}, nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	if _, ok := s.q.Statement.(*query.Select); !ok {
+		return nil, errors.New("use Exec to run statements other than SELECT")
+	}
+	res, err := s.execute(args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: res.Columns, rows: res.Rows}, nil
+}
+
+func (s *stmt) execute(args []driver.Value) (*query.Result, error) {
+	values, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return query.Execute(s.c.backend, s.c.tx, s.q, values)
+}
+
+func convertArgs(args []driver.Value) ([]any, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil, int64, float64, bool, string:
+			values[i] = v
+		case []byte:
+			values[i] = string(v)
+		default:
+			return nil, fmt.Errorf("argument %d: %T is not supported", i+1, arg)
+		}
+	}
+	return values, nil
+}
+
+type result struct {
+	id   int64
+	rows int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.id, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rows, nil
+}
+
+type rows struct {
+	columns []common.TableColumn
+	rows    [][]any
+	pos     int
+}
+
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, col := range r.columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (r *rows) Close() error {
+	r.rows = nil
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	for i, val := range r.rows[r.pos] {
+		if id, ok := val.(common.RowIdType); ok {
+			val = int64(id)
+		}
+		dest[i] = val
+	}
+	r.pos++
+	return nil
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(common.ColumnsTypeEnum[r.columns[index].Type])
+}
+
+func (r *rows) ColumnTypeNullable(index int) (bool, bool) {
+	return r.columns[index].IsOptional, true
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	col := r.columns[index]
+	switch {
+	case col == query.IdColumn:
+		return reflect.TypeOf(int64(0))
+	case col.Type == common.StringColumn:
+		return reflect.TypeOf("")
+	case col.Type == common.BoolColumn:
+		return reflect.TypeOf(false)
+	}
+	return reflect.TypeOf(float64(0))
+}
@@ -0,0 +1,52 @@
+// Package driver registers curiodb with database/sql:
+//
+//	import _ "github.com/idkarn/curiodb/pkg/driver"
+//
+//	db, err := sql.Open("curiodb", "file:/var/lib/curiodb")  // embedded
+//	db, err := sql.Open("curiodb", "http://localhost:3141")  // a running server
+//
+// Statements are the SQL subset of the query package. Placeholders are
+// written as ? or $1, $2...
+package driver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+const DRIVER_NAME = "curiodb"
+
+func init() {
+	sql.Register(DRIVER_NAME, &Driver{})
+}
+
+type Driver struct{}
+
+// Open connects to the database named by dsn, either `file:<dir>` or the
+// `http://` or `https://` address of a server.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	var b backend
+	var err error
+	switch {
+	case strings.HasPrefix(dsn, "file:"):
+		b, err = openEmbedded(strings.TrimPrefix(dsn, "file:"))
+	case strings.HasPrefix(dsn, "http://"), strings.HasPrefix(dsn, "https://"):
+		b = newRemote(dsn)
+	default:
+		err = fmt.Errorf("unsupported data source %q, use file:<dir> or http://<host>:<port>", dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conn{backend: b}, nil
+}
+
+// backend runs the statements of a connection.
+type backend interface {
+	query.Backend
+	close() error
+}
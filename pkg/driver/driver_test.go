@@ -0,0 +1,203 @@
+package driver
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/api"
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/middleware"
+)
+
+func openEmbeddedTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open(DRIVER_NAME, "file:"+t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func openRemoteTestDB(t *testing.T) *sql.DB {
+	common.Default = common.NewDB()
+	common.Default.Config(common.DatabaseStore{
+		Tables:         []common.Table{{}},
+		TablesMetaData: []common.TableMetaData{{}},
+	})
+
+	mux := http.NewServeMux()
+	for _, route := range []middleware.Route{
+		middleware.NewRouteInfo("POST", "/table/new", api.NewTableHandler),
+		middleware.NewRouteInfo("GET", "/table/list", api.ListTablesHandler),
+		middleware.NewRouteInfo("POST", "/column/new", api.NewColumnHandler),
+		middleware.NewRouteInfo("POST", "/row/new", api.NewRowHandler),
+		middleware.NewRouteInfo("POST", "/row/get", api.GetRowHandler),
+		middleware.NewRouteInfo("POST", "/row/update", api.UpdateRowHandler),
+		middleware.NewRouteInfo("POST", "/row/delete", api.DeleteRowHandler),
+		middleware.NewRouteInfo("POST", "/tx/begin", api.TxBeginHandler),
+		middleware.NewRouteInfo("POST", "/tx/commit", api.TxCommitHandler),
+		middleware.NewRouteInfo("POST", "/tx/rollback", api.TxRollbackHandler),
+	} {
+		route := route
+		mux.HandleFunc(route.Path, func(w http.ResponseWriter, r *http.Request) {
+			middleware.HandleWith(w, r, route)
+		})
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	db, err := sql.Open(DRIVER_NAME, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func exec(t *testing.T, db interface {
+	Exec(string, ...any) (sql.Result, error)
+}, query string, args ...any) sql.Result {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+	return res
+}
+
+type person struct {
+	id   int64
+	name string
+	age  sql.NullFloat64
+}
+
+func people(t *testing.T, db *sql.DB, query string, args ...any) []person {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+	defer rows.Close()
+
+	var found []person
+	for rows.Next() {
+		var p person
+		if err := rows.Scan(&p.id, &p.name, &p.age); err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, p)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func testStatements(t *testing.T, db *sql.DB) {
+	exec(t, db, "CREATE TABLE people (name STRING, age NUMBER NULL)")
+
+	res := exec(t, db, "INSERT INTO people (name, age) VALUES (?, ?), ('bob', NULL), ($1, 7)", "alice", 30)
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Fatalf("expected 3 inserted rows, but returned %d", n)
+	}
+	if id, _ := res.LastInsertId(); id != 2 {
+		t.Fatalf("expected the last id 2, but returned %d", id)
+	}
+
+	found := people(t, db, "SELECT id, name, age FROM people WHERE name LIKE 'a%' AND age > ?", 10)
+	if len(found) != 1 || found[0].name != "alice" || found[0].age.Float64 != 30 {
+		t.Fatalf("expected alice, but returned %+v", found)
+	}
+
+	res = exec(t, db, "UPDATE people SET age = ? WHERE name = 'bob'", 40)
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("expected 1 updated row, but returned %d", n)
+	}
+	res = exec(t, db, "DELETE FROM people WHERE id = ?", 0)
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("expected 1 deleted row, but returned %d", n)
+	}
+
+	found = people(t, db, "SELECT * FROM people WHERE age > 35")
+	if len(found) != 1 || found[0].name != "bob" || found[0].id != 1 {
+		t.Fatalf("expected bob, but returned %+v", found)
+	}
+
+	rows, err := db.Query("SELECT * FROM people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, _ := rows.ColumnTypes()
+	rows.Close()
+	if types[1].DatabaseTypeName() != "STRING" || types[2].DatabaseTypeName() != "NUMBER" {
+		t.Fatalf("expected STRING and NUMBER columns, but returned %s and %s",
+			types[1].DatabaseTypeName(), types[2].DatabaseTypeName())
+	}
+	if nullable, _ := types[2].Nullable(); !nullable {
+		t.Fatal("expected age to be nullable")
+	}
+
+	if _, err := db.Exec("INSERT INTO people (age) VALUES (1)"); err == nil {
+		t.Fatal("expected a row without a name to be rejected")
+	}
+}
+
+func testTransactions(t *testing.T, db *sql.DB) {
+	exec(t, db, "CREATE TABLE orders (item STRING)")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(t, tx, "INSERT INTO orders (item) VALUES ('book')")
+	if n := count(t, db, "orders"); n != 0 {
+		t.Fatalf("expected an uncommitted row not to be visible, but found %d", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(t, tx, "DELETE FROM orders WHERE item = 'book'")
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "orders"); n != 1 {
+		t.Fatalf("expected the committed row to survive a rollback, but found %d", n)
+	}
+}
+
+func count(t *testing.T, db *sql.DB, table string) int {
+	rows, err := db.Query("SELECT id FROM " + table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n
+}
+
+func TestEmbedded(t *testing.T) {
+	db := openEmbeddedTestDB(t)
+	testStatements(t, db)
+	testTransactions(t, db)
+}
+
+func TestRemote(t *testing.T) {
+	db := openRemoteTestDB(t)
+	testStatements(t, db)
+	testTransactions(t, db)
+}
+
+func TestUnsupportedDataSource(t *testing.T) {
+	db, _ := sql.Open(DRIVER_NAME, "postgres://localhost")
+	if err := db.Ping(); err == nil {
+		t.Fatal("expected an unknown data source to be rejected")
+	}
+}
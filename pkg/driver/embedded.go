@@ -0,0 +1,61 @@
+package driver
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/engine"
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+// a directory can be opened once, connections of a pool share the database
+var embedded = struct {
+	sync.Mutex
+	dbs map[string]*sharedDB
+}{dbs: map[string]*sharedDB{}}
+
+type sharedDB struct {
+	db    *common.DB
+	conns int
+}
+
+type embeddedBackend struct {
+	query.Backend
+	dir string
+}
+
+func openEmbedded(dir string) (*embeddedBackend, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	embedded.Lock()
+	defer embedded.Unlock()
+
+	shared, ok := embedded.dbs[dir]
+	if !ok {
+		db, err := common.Open(dir, common.DefaultOptions())
+		if err != nil {
+			return nil, err
+		}
+		shared = &sharedDB{db: db}
+		embedded.dbs[dir] = shared
+	}
+	shared.conns++
+	return &embeddedBackend{engine.NewBackend(shared.db), dir}, nil
+}
+
+func (b *embeddedBackend) close() error {
+	embedded.Lock()
+	defer embedded.Unlock()
+
+	shared := embedded.dbs[b.dir]
+	shared.conns--
+	if shared.conns > 0 {
+		return nil
+	}
+	delete(embedded.dbs, b.dir)
+	return shared.db.Close()
+}
@@ -0,0 +1,200 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+const REMOTE_TIMEOUT = 30 * time.Second
+
+// remoteBackend talks to a curiodb server with its JSON API.
+type remoteBackend struct {
+	base   string
+	client *http.Client
+}
+
+func newRemote(base string) *remoteBackend {
+	return &remoteBackend{
+		base:   strings.TrimSuffix(base, "/"),
+		client: &http.Client{Timeout: REMOTE_TIMEOUT},
+	}
+}
+
+func (b *remoteBackend) close() error {
+	return nil
+}
+
+// call sends body to the endpoint and returns the raw response, responses
+// other than 200 are turned into errors with the text the server sent.
+func (b *remoteBackend) call(method, path string, body any) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, b.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(strings.TrimSpace(string(content)))
+	}
+	return content, nil
+}
+
+func (b *remoteBackend) callId(path string, body any) (uint64, error) {
+	content, err := b.call("POST", path, body)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+func (b *remoteBackend) CreateTable(name string) error {
+	_, err := b.callId("/table/new", common.NewTable{Name: name})
+	return err
+}
+
+func (b *remoteBackend) DropTable(name string) error {
+	_, err := b.call("POST", "/table/drop", common.DropTableType{Table: common.TableRef{Name: name, ByName: true}})
+	return err
+}
+
+func (b *remoteBackend) AddColumn(tx common.TxIdType, table string, col query.ColumnDef) error {
+	_, err := b.callId("/column/new", common.NewColumn{
+		Name:     col.Name,
+		Table:    common.TableRef{Name: table, ByName: true},
+		Type:     common.ColumnsTypeEnum[col.Type],
+		Optional: col.Optional,
+		Unique:   col.Unique,
+		Primary:  col.Primary,
+		Tx:       tx,
+	})
+	return err
+}
+
+// Columns returns the committed columns, the ones a transaction added are
+// not listed by the server.
+func (b *remoteBackend) Columns(_ common.TxIdType, table string) ([]common.TableColumn, error) {
+	content, err := b.call("GET", "/table/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var tables []common.TableMetaData
+	if err := json.Unmarshal(content, &tables); err != nil {
+		return nil, err
+	}
+	for _, meta := range tables {
+		if meta.Name == table {
+			return meta.Columns, nil
+		}
+	}
+	return nil, fmt.Errorf(common.ResponseStrings["T5"])
+}
+
+func (b *remoteBackend) Insert(tx common.TxIdType, table string, values map[string]any) (common.RowIdType, error) {
+	rid, err := b.callId("/row/new", common.NewRow{
+		Columns: values,
+		Table:   common.TableRef{Name: table, ByName: true},
+		Tx:      tx,
+	})
+	return common.RowIdType(rid), err
+}
+
+type filterRequest struct {
+	Table   common.TableRef   `json:"table"`
+	Tx      common.TxIdType   `json:"tx,omitempty"`
+	Filter  common.FilterType `json:"filter"`
+	Columns map[string]any    `json:"columns,omitempty"`
+	Sort    []common.SortKey  `json:"sort,omitempty"`
+}
+
+func (b *remoteBackend) Search(tx common.TxIdType, table string, filter common.FilterType, order []common.SortKey) ([]common.Row[string], error) {
+	content, err := b.call("POST", "/row/get", filterRequest{
+		Table:  common.TableRef{Name: table, ByName: true},
+		Tx:     tx,
+		Filter: filter,
+		Sort:   order,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []common.Row[string]
+	err = json.Unmarshal(content, &rows)
+	return rows, err
+}
+
+// batch runs an update or delete and returns how many rows it changed.
+func (b *remoteBackend) batch(path string, req filterRequest) (int, error) {
+	content, err := b.call("POST", path, req)
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Ok     bool               `json:"ok"`
+		Failed []common.RowIdType `json:"failed"`
+		Count  int                `json:"count"`
+	}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return 0, err
+	}
+	if !result.Ok {
+		return 0, &common.RowsNotFoundError{Rows: result.Failed}
+	}
+	return result.Count, nil
+}
+
+func (b *remoteBackend) Update(tx common.TxIdType, table string, filter common.FilterType, values map[string]any) (int, error) {
+	return b.batch("/row/update", filterRequest{
+		Table:   common.TableRef{Name: table, ByName: true},
+		Tx:      tx,
+		Filter:  filter,
+		Columns: values,
+	})
+}
+
+func (b *remoteBackend) Delete(tx common.TxIdType, table string, filter common.FilterType) (int, error) {
+	return b.batch("/row/delete", filterRequest{
+		Table:  common.TableRef{Name: table, ByName: true},
+		Tx:     tx,
+		Filter: filter,
+	})
+}
+
+func (b *remoteBackend) Begin() (common.TxIdType, error) {
+	id, err := b.callId("/tx/begin", nil)
+	return common.TxIdType(id), err
+}
+
+func (b *remoteBackend) Commit(tx common.TxIdType) error {
+	_, err := b.call("POST", "/tx/commit", common.TxData{Tx: tx})
+	return err
+}
+
+func (b *remoteBackend) Rollback(tx common.TxIdType) error {
+	_, err := b.call("POST", "/tx/rollback", common.TxData{Tx: tx})
+	return err
+}
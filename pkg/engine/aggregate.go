@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+const (
+	COUNT          = "count"
+	SUM            = "sum"
+	AVG            = "avg"
+	MIN            = "min"
+	MAX            = "max"
+	COUNT_DISTINCT = "count_distinct"
+)
+
+// AggregateColumn names a result of an aggregation and gives its type, one
+// of ColumnsTypeEnum.
+type AggregateColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// AggregateResult has a row per group, with the values of the group by
+// columns then the aggregates. Missing values are null.
+type AggregateResult struct {
+	Columns []AggregateColumn `json:"columns"`
+	Rows    []map[string]any  `json:"rows"`
+}
+
+type accumulator interface {
+	add(v any)
+	result() any
+}
+
+type countAcc struct{ n int }
+type sumAcc struct{ sum float64 }
+type avgAcc struct {
+	sum float64
+	n   int
+}
+type extremeAcc struct {
+	v   any
+	max bool
+}
+type distinctAcc struct{ seen map[any]bool }
+
+func (a *countAcc) add(v any) {
+	if v != nil {
+		a.n++
+	}
+}
+
+func (a *sumAcc) add(v any) {
+	if v != nil {
+		a.sum += v.(float64)
+	}
+}
+
+func (a *avgAcc) add(v any) {
+	if v != nil {
+		a.sum += v.(float64)
+		a.n++
+	}
+}
+
+func (a *extremeAcc) add(v any) {
+	if v == nil {
+		return
+	}
+	if c := common.CompareValues(v, a.v); a.v == nil || (a.max && c > 0) || (!a.max && c < 0) {
+		a.v = v
+	}
+}
+
+func (a *distinctAcc) add(v any) {
+	if v != nil {
+		a.seen[v] = true
+	}
+}
+
+func (a *countAcc) result() any    { return float64(a.n) }
+func (a *sumAcc) result() any      { return a.sum }
+func (a *extremeAcc) result() any  { return a.v }
+func (a *distinctAcc) result() any { return float64(len(a.seen)) }
+
+func (a *avgAcc) result() any {
+	if a.n == 0 {
+		return nil
+	}
+	return a.sum / float64(a.n)
+}
+
+// aggregate is a checked Aggregation.
+type aggregate struct {
+	name   string
+	op     string
+	column *common.TableColumn // nil for a count of rows
+	typ    uint8
+}
+
+func (a aggregate) accumulator() accumulator {
+	switch a.op {
+	case SUM:
+		return &sumAcc{}
+	case AVG:
+		return &avgAcc{}
+	case MIN, MAX:
+		return &extremeAcc{max: a.op == MAX}
+	case COUNT_DISTINCT:
+		return &distinctAcc{seen: map[any]bool{}}
+	}
+	return &countAcc{}
+}
+
+func compileAggregate(agg common.Aggregation, columns []common.TableColumn) (aggregate, error) {
+	result := aggregate{name: agg.As, op: agg.Op, typ: common.NumberColumn}
+	if result.name == "" {
+		result.name = agg.Op
+		if agg.Column != "" {
+			result.name += "_" + agg.Column
+		}
+	}
+
+	var allowed []uint8
+	switch agg.Op {
+	case COUNT:
+		if agg.Column == "" {
+			return result, nil
+		}
+		allowed = anyType
+	case SUM, AVG:
+		allowed = numberType
+	case MIN, MAX, COUNT_DISTINCT:
+		allowed = ordered
+	default:
+		return result, fmt.Errorf("unknown aggregate %q", agg.Op)
+	}
+
+	if agg.Column == "" {
+		return result, fmt.Errorf("%s needs a column", agg.Op)
+	}
+	col, ok := findColumn(columns, agg.Column)
+	if !ok {
+		return result, fmt.Errorf("%s: %s", agg.Column, common.ResponseStrings["C2"])
+	}
+	if !typeIn(col.Type, allowed) {
+		return result, fmt.Errorf("%s is not supported for %s columns", agg.Op, common.ColumnsTypeEnum[col.Type])
+	}
+	result.column = &col
+	if agg.Op == MIN || agg.Op == MAX {
+		result.typ = col.Type
+	}
+	return result, nil
+}
+
+func columnValue(row common.Row[common.ColumnIdType], col common.TableColumn) any {
+	if col.Name == "id" {
+		return float64(row.Id)
+	}
+	return row.Columns[col.Id]
+}
+
+type group struct {
+	key  []any
+	accs []accumulator
+}
+
+// Aggregate groups the rows matching the filter and computes the aggregates
+// of each group. Without group by columns all the rows make one group, even
+// when there are none.
+func Aggregate(db *common.DB, tx *common.Tx, tid common.TableIdType, data common.AggregateData) (AggregateResult, error) {
+	if len(data.Aggregates) == 0 && len(data.GroupBy) == 0 {
+		return AggregateResult{}, errors.New("nothing to aggregate")
+	}
+
+	var result AggregateResult
+	var groups []*group
+	err := findRows(db, tx, tid, data.Filter, func(tableRows []common.Row[common.ColumnIdType], columns []common.TableColumn, pred Predicate) error {
+		seen := map[string]bool{}
+		addColumn := func(name string, typ uint8) error {
+			if seen[name] {
+				return fmt.Errorf("%q is computed twice, name one with as", name)
+			}
+			seen[name] = true
+			result.Columns = append(result.Columns, AggregateColumn{name, common.ColumnsTypeEnum[typ]})
+			return nil
+		}
+
+		var keyColumns []common.TableColumn
+		for _, name := range data.GroupBy {
+			col, ok := findColumn(columns, name)
+			if !ok {
+				return fmt.Errorf("%s: %s", name, common.ResponseStrings["C2"])
+			}
+			if err := addColumn(name, col.Type); err != nil {
+				return err
+			}
+			keyColumns = append(keyColumns, col)
+		}
+		aggs := make([]aggregate, len(data.Aggregates))
+		for i, agg := range data.Aggregates {
+			compiled, err := compileAggregate(agg, columns)
+			if err != nil {
+				return err
+			}
+			aggs[i] = compiled
+			if err := addColumn(aggs[i].name, aggs[i].typ); err != nil {
+				return err
+			}
+		}
+
+		newGroup := func(key []any) *group {
+			g := &group{key: key, accs: make([]accumulator, len(aggs))}
+			for i, agg := range aggs {
+				g.accs[i] = agg.accumulator()
+			}
+			groups = append(groups, g)
+			return g
+		}
+		byKey := map[string]*group{}
+		if len(keyColumns) == 0 {
+			byKey[""] = newGroup(nil)
+		}
+
+		for _, row := range tableRows {
+			if row.Deleted || !pred.Match(row) {
+				continue
+			}
+			key := make([]any, len(keyColumns))
+			for i, col := range keyColumns {
+				key[i] = columnValue(row, col)
+			}
+			id := ""
+			if len(key) > 0 {
+				encoded, _ := json.Marshal(key)
+				id = string(encoded)
+			}
+			g, ok := byKey[id]
+			if !ok {
+				g = newGroup(key)
+				byKey[id] = g
+			}
+			for i, agg := range aggs {
+				if agg.column == nil {
+					g.accs[i].add(true)
+				} else {
+					g.accs[i].add(columnValue(row, *agg.column))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return AggregateResult{}, err
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		for k := range groups[i].key {
+			if c := common.CompareValues(groups[i].key[k], groups[j].key[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	// having is matched against the results as if they were the columns of
+	// a table, a result without a value is null as in SQL and matches no
+	// condition
+	having := make([]common.TableColumn, len(result.Columns))
+	for i, col := range result.Columns {
+		typ, _ := common.ColumnTypeByName(col.Type)
+		having[i] = common.TableColumn{Id: common.ColumnIdType(i), Name: col.Name, Type: typ}
+	}
+	pred, err := CompileNullFilter(data.Having, having)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+
+	result.Rows = []map[string]any{}
+	for _, g := range groups {
+		values := append(append([]any{}, g.key...), make([]any, len(g.accs))...)
+		for i, acc := range g.accs {
+			values[len(g.key)+i] = acc.result()
+		}
+		row := common.Row[common.ColumnIdType]{Columns: map[common.ColumnIdType]any{}}
+		out := make(map[string]any, len(values))
+		for i, v := range values {
+			out[result.Columns[i].Name] = v
+			if v != nil {
+				row.Columns[common.ColumnIdType(i)] = v
+			}
+		}
+		if pred.Match(row) {
+			result.Rows = append(result.Rows, out)
+		}
+	}
+	return result, nil
+}
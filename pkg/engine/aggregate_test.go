@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func configSales(t *testing.T) common.TableIdType {
+	common.Default = common.NewDB()
+	common.Default.Config(common.DatabaseStore{
+		Tables:         []common.Table{{}},
+		TablesMetaData: []common.TableMetaData{{}},
+	})
+	for _, src := range []string{
+		"CREATE TABLE sales (region STRING, item STRING, amount NUMBER NULL)",
+		`INSERT INTO sales (region, item, amount) VALUES
+			('north', 'tea', 10), ('north', 'tea', 30), ('north', 'cake', 5),
+			('south', 'tea', 20), ('south', 'cake', NULL), ('east', 'cake', 7)`,
+	} {
+		runSQL(t, src)
+	}
+	tid, err := common.Default.FindTableByName("sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tid
+}
+
+func runAggregate(t *testing.T, tid common.TableIdType, data common.AggregateData) AggregateResult {
+	result, err := Aggregate(common.Default, nil, tid, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestAggregateGroups(t *testing.T) {
+	tid := configSales(t)
+	result := runAggregate(t, tid, common.AggregateData{
+		GroupBy: []string{"region"},
+		Aggregates: []common.Aggregation{
+			{Op: COUNT},
+			{Op: COUNT, Column: "amount"},
+			{Op: SUM, Column: "amount", As: "total"},
+			{Op: AVG, Column: "amount"},
+			{Op: MAX, Column: "item"},
+			{Op: COUNT_DISTINCT, Column: "item"},
+		},
+	})
+
+	columns := []AggregateColumn{
+		{"region", "string"}, {"count", "number"}, {"count_amount", "number"}, {"total", "number"},
+		{"avg_amount", "number"}, {"max_item", "string"}, {"count_distinct_item", "number"},
+	}
+	if !reflect.DeepEqual(result.Columns, columns) {
+		t.Fatalf("expected: %+v, but returned %+v", columns, result.Columns)
+	}
+	rows := []map[string]any{
+		{"region": "east", "count": 1.0, "count_amount": 1.0, "total": 7.0, "avg_amount": 7.0, "max_item": "cake", "count_distinct_item": 1.0},
+		{"region": "north", "count": 3.0, "count_amount": 3.0, "total": 45.0, "avg_amount": 15.0, "max_item": "tea", "count_distinct_item": 2.0},
+		{"region": "south", "count": 2.0, "count_amount": 1.0, "total": 20.0, "avg_amount": 20.0, "max_item": "tea", "count_distinct_item": 2.0},
+	}
+	if !reflect.DeepEqual(result.Rows, rows) {
+		t.Fatalf("expected: %+v, but returned %+v", rows, result.Rows)
+	}
+}
+
+func TestAggregateFilterHaving(t *testing.T) {
+	tid := configSales(t)
+	data := common.AggregateData{
+		GroupBy:    []string{"region", "item"},
+		Aggregates: []common.Aggregation{{Op: MIN, Column: "amount"}},
+		Having:     common.Where(common.FilterType{"min_amount": {">=10"}}),
+	}
+	data.Filter = common.Where(common.FilterType{"item": {"=tea"}})
+
+	rows := []map[string]any{
+		{"region": "north", "item": "tea", "min_amount": 10.0},
+		{"region": "south", "item": "tea", "min_amount": 20.0},
+	}
+	if result := runAggregate(t, tid, data); !reflect.DeepEqual(result.Rows, rows) {
+		t.Fatalf("expected: %+v, but returned %+v", rows, result.Rows)
+	}
+
+	// the minimum of south cake is null, it matches neither the condition
+	// nor its negation
+	rows = []map[string]any{
+		{"region": "east", "item": "cake", "min_amount": 7.0},
+		{"region": "north", "item": "cake", "min_amount": 5.0},
+	}
+	for _, having := range []common.FilterExpr{
+		common.Where(common.FilterType{"min_amount": {"<10"}}),
+		{Not: &common.FilterExpr{Fields: common.FilterType{"min_amount": {">=10"}}}},
+		{Or: []common.FilterExpr{common.Where(common.FilterType{"min_amount": {"<6"}}), common.Where(common.FilterType{"min_amount": {"=7"}})}},
+	} {
+		data = common.AggregateData{
+			GroupBy:    []string{"region", "item"},
+			Aggregates: []common.Aggregation{{Op: MIN, Column: "amount"}},
+			Having:     having,
+		}
+		if result := runAggregate(t, tid, data); !reflect.DeepEqual(result.Rows, rows) {
+			t.Fatalf("%+v: expected: %+v, but returned %+v", having, rows, result.Rows)
+		}
+	}
+
+	// without groups there is one row even if nothing matches
+	data = common.AggregateData{Aggregates: []common.Aggregation{{Op: COUNT}, {Op: AVG, Column: "amount"}}}
+	data.Filter = common.Where(common.FilterType{"region": {"=west"}})
+	rows = []map[string]any{{"count": 0.0, "avg_amount": nil}}
+	if result := runAggregate(t, tid, data); !reflect.DeepEqual(result.Rows, rows) {
+		t.Fatalf("expected: %+v, but returned %+v", rows, result.Rows)
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	tid := configSales(t)
+	for _, data := range []common.AggregateData{
+		{},
+		{Aggregates: []common.Aggregation{{Op: "median", Column: "amount"}}},
+		{Aggregates: []common.Aggregation{{Op: SUM, Column: "item"}}},
+		{Aggregates: []common.Aggregation{{Op: SUM}}},
+		{Aggregates: []common.Aggregation{{Op: COUNT}, {Op: COUNT}}},
+		{GroupBy: []string{"regoin"}},
+		{Aggregates: []common.Aggregation{{Op: COUNT}}, Having: common.Where(common.FilterType{"total": {">1"}})},
+	} {
+		if _, err := Aggregate(common.Default, nil, tid, data); err == nil {
+			t.Fatalf("expected %+v to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+// dbBackend runs the statements of the query package against a database.
+type dbBackend struct {
+	db *common.DB
+}
+
+func NewBackend(db *common.DB) query.Backend {
+	return &dbBackend{db}
+}
+
+// resolve finds the table and the transaction of an operation.
+func (b *dbBackend) resolve(txid common.TxIdType, table string) (*common.Tx, common.TableIdType, error) {
+	var tx *common.Tx
+	if txid != 0 {
+		var err error
+		if tx, err = b.db.Transactions.Get(txid); err != nil {
+			return nil, 0, err
+		}
+	}
+	tid, err := b.db.FindTableByName(table)
+	return tx, tid, err
+}
+
+func (b *dbBackend) CreateTable(name string) error {
+	_, err := b.db.CreateTable(name)
+	return err
+}
+
+func (b *dbBackend) DropTable(name string) error {
+	tid, err := b.db.FindTableByName(name)
+	if err != nil {
+		return err
+	}
+	return b.db.DropTable(tid)
+}
+
+func (b *dbBackend) AddColumn(txid common.TxIdType, table string, col query.ColumnDef) error {
+	tx, tid, err := b.resolve(txid, table)
+	if err != nil {
+		return err
+	}
+	column := common.TableColumn{
+		Name:       col.Name,
+		Type:       col.Type,
+		IsOptional: col.Optional,
+		IsUnique:   col.Unique,
+		IsPrimary:  col.Primary,
+	}
+	if tx != nil {
+		_, err = tx.AddColumn(tid, column)
+	} else {
+		_, err = b.db.AddColumn(tid, column)
+	}
+	return err
+}
+
+func (b *dbBackend) Columns(txid common.TxIdType, table string) ([]common.TableColumn, error) {
+	tx, tid, err := b.resolve(txid, table)
+	if err != nil {
+		return nil, err
+	}
+	var columns []common.TableColumn
+	if tx != nil {
+		err = tx.ReadTable(tid, func(_ []common.Row[common.ColumnIdType], cols []common.TableColumn) error {
+			columns = append(columns, cols...)
+			return nil
+		})
+	} else {
+		err = b.db.ReadTable(tid, func(_ *common.Table, meta *common.TableMetaData) error {
+			columns = append(columns, meta.Columns...)
+			return nil
+		})
+	}
+	return columns, err
+}
+
+func (b *dbBackend) prepare(tx *common.Tx, tid common.TableIdType, values map[string]any, partial bool) (map[common.ColumnIdType]any, error) {
+	if tx != nil {
+		return tx.PrepareColumns(tid, values, partial)
+	}
+	return b.db.PrepareColumns(tid, values, partial)
+}
+
+func (b *dbBackend) Insert(txid common.TxIdType, table string, values map[string]any) (common.RowIdType, error) {
+	tx, tid, err := b.resolve(txid, table)
+	if err != nil {
+		return 0, err
+	}
+	cols, err := b.prepare(tx, tid, values, false)
+	if err != nil {
+		return 0, err
+	}
+	if tx != nil {
+		return tx.AddRow(tid, cols)
+	}
+	return b.db.AddNewRow(tid, cols)
+}
+
+func (b *dbBackend) Search(txid common.TxIdType, table string, filter common.FilterType, order []common.SortKey) ([]common.Row[string], error) {
+	tx, tid, err := b.resolve(txid, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) == 0 {
+		return SearchInTx(b.db, tx, tid, common.Where(filter))
+	}
+	page, err := SearchPage(b.db, tx, tid, common.Where(filter), common.Page{Sort: order}, nil)
+	return page.Rows, err
+}
+
+func (b *dbBackend) Update(txid common.TxIdType, table string, filter common.FilterType, values map[string]any) (int, error) {
+	tx, tid, err := b.resolve(txid, table)
+	if err != nil {
+		return 0, err
+	}
+	diff, err := b.prepare(tx, tid, values, true)
+	if err != nil {
+		return 0, err
+	}
+	ids, _, err := UpdateInTx(b.db, tx, tid, common.Where(filter), diff)
+	return len(ids), err
+}
+
+func (b *dbBackend) Delete(txid common.TxIdType, table string, filter common.FilterType) (int, error) {
+	tx, tid, err := b.resolve(txid, table)
+	if err != nil {
+		return 0, err
+	}
+	ids, _, err := DeleteInTx(b.db, tx, tid, common.Where(filter))
+	return len(ids), err
+}
+
+func (b *dbBackend) Begin() (common.TxIdType, error) {
+	return b.db.Transactions.Begin().Id, nil
+}
+
+func (b *dbBackend) Commit(tx common.TxIdType) error {
+	return b.db.Transactions.Commit(tx)
+}
+
+func (b *dbBackend) Rollback(tx common.TxIdType) error {
+	return b.db.Transactions.Rollback(tx)
+}
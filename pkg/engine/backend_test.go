@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+	"github.com/idkarn/curiodb/pkg/query"
+)
+
+func runSQL(t *testing.T, src string, args ...any) *query.Result {
+	q, err := query.Parse(src)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	res, err := query.Execute(NewBackend(common.Default), 0, q, args)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return res
+}
+
+func configQuery(t *testing.T) {
+	common.Default = common.NewDB()
+	common.Default.Config(common.DatabaseStore{
+		Tables:         []common.Table{{}},
+		TablesMetaData: []common.TableMetaData{{}},
+	})
+	runSQL(t, "CREATE TABLE users (name STRING, age NUMBER NULL)")
+	runSQL(t, "INSERT INTO users (name, age) VALUES ('alice', 30), ('bob', 25), ('carol', NULL), ('dave', 41)")
+}
+
+func TestBackendUpdateDelete(t *testing.T) {
+	configQuery(t)
+	if res := runSQL(t, "UPDATE users SET age = 26 WHERE age = 25"); res.Count != 1 {
+		t.Fatalf("expected: 1 updated row, but returned %d", res.Count)
+	}
+	if res := runSQL(t, "UPDATE users SET age = 27 WHERE age = 25"); res.Count != 0 {
+		t.Fatalf("expected: 0 updated rows, but returned %d", res.Count)
+	}
+	if res := runSQL(t, "DELETE FROM users WHERE age > 26"); res.Count != 2 {
+		t.Fatalf("expected: 2 deleted rows, but returned %d", res.Count)
+	}
+	if res := runSQL(t, "SELECT name FROM users ORDER BY name"); !(len(res.Rows) == 2 && res.Rows[0][0] == "bob" && res.Rows[1][0] == "carol") {
+		t.Fatalf("expected: bob and carol, but returned %+v", res.Rows)
+	}
+}
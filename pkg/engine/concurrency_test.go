@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func configStorage(t *testing.T) {
+	storage, err := common.OpenStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := common.OpenLog(storage.LogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Replay(0, common.Default.ApplyLogRecord); err != nil {
+		t.Fatal(err)
+	}
+	common.Default.Disk, common.Default.Journal = storage, journal
+	t.Cleanup(func() {
+		common.Default.Disk, common.Default.Journal = nil, nil
+		journal.Close()
+		storage.Close()
+	})
+}
+
+func TestConcurrentLoad(t *testing.T) {
+	config()
+	configStorage(t)
+
+	const writers = 4
+	const rowsPerWriter = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	report := func(err error) {
+		if err != nil {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	}
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rowsPerWriter; i++ {
+				_, err := common.Default.AddNewRow(0, map[common.ColumnIdType]interface{}{
+					0: fmt.Sprintf("writer%d", w),
+					1: i,
+				})
+				report(err)
+			}
+		}(w)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rowsPerWriter; i++ {
+			rows, err := SearchForRecords(common.Default, 0, common.FilterType{"name": {"<writer"}})
+			report(err)
+			ids := make([]common.RowIdType, len(rows))
+			for i, row := range rows {
+				ids[i] = row.Id
+			}
+			_, err = common.Default.UpdateRows(0, ids, map[common.ColumnIdType]interface{}{1: 1})
+			report(err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			_, err := common.Default.CreateTable(fmt.Sprintf("table%d", i))
+			report(err)
+			_, err = common.Default.TakeSnapshot()
+			report(err)
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{"name": {"<writer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != writers*rowsPerWriter {
+		t.Fatalf("expected %d rows, but returned %d", writers*rowsPerWriter, len(rows))
+	}
+}
+
+func TestConcurrentUpdateMatching(t *testing.T) {
+	config()
+	filter := common.Where(common.FilterType{"name": {"=none"}, "age": {"=0"}})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	updated := 0
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids, _, err := UpdateInTx(common.Default, nil, 0, filter, map[common.ColumnIdType]interface{}{1: 1.0})
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			updated += len(ids)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// once a writer changed the row, it no longer matches for the others
+	if updated != 1 {
+		t.Fatalf("expected: 1 updated row, but returned %d", updated)
+	}
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// Predicate is a compiled filter document, it tells whether a row matches.
+type Predicate interface {
+	Match(row common.Row[common.ColumnIdType]) bool
+}
+
+type allOf []Predicate
+type anyOf []Predicate
+type noneOf struct{ p Predicate }
+
+func (ps allOf) Match(row common.Row[common.ColumnIdType]) bool {
+	for _, p := range ps {
+		if !p.Match(row) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ps anyOf) Match(row common.Row[common.ColumnIdType]) bool {
+	for _, p := range ps {
+		if p.Match(row) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n noneOf) Match(row common.Row[common.ColumnIdType]) bool {
+	return !n.p.Match(row)
+}
+
+// idCondition compares the row id.
+type idCondition struct {
+	test func(any) bool
+}
+
+func (c idCondition) Match(row common.Row[common.ColumnIdType]) bool {
+	return c.test(float64(row.Id))
+}
+
+// columnCondition compares a column, rows without a value for it give
+// missing.
+type columnCondition struct {
+	column  common.ColumnIdType
+	test    func(any) bool
+	missing bool
+}
+
+func (c columnCondition) Match(row common.Row[common.ColumnIdType]) bool {
+	val, ok := row.Columns[c.column]
+	if !ok {
+		return c.missing
+	}
+	return c.test(val)
+}
+
+// CompileFilter checks the filter against the columns of the table and
+// builds the predicate rows are matched with. Rows without a value for a
+// column match its conditions.
+func CompileFilter(filter common.FilterExpr, columns []common.TableColumn) (Predicate, error) {
+	return compileFilter(filter, columns, true, false)
+}
+
+// CompileNullFilter is CompileFilter with the null of SQL: a condition on a
+// column without a value is unknown, and neither it nor its negation
+// matches.
+func CompileNullFilter(filter common.FilterExpr, columns []common.TableColumn) (Predicate, error) {
+	return compileFilter(filter, columns, false, true)
+}
+
+// compileFilter gives missing for conditions on columns without a value.
+// With unknown those conditions are unknown instead: a not matches only the
+// rows its filter is known not to match, so it is compiled with the
+// opposite of missing.
+func compileFilter(filter common.FilterExpr, columns []common.TableColumn, missing, unknown bool) (Predicate, error) {
+	var preds allOf
+	for field, conds := range filter.Fields {
+		for _, cond := range conds {
+			p, err := compileCondition(field, cond, columns, missing)
+			if err != nil {
+				return nil, err
+			}
+			preds = append(preds, p)
+		}
+	}
+
+	for _, sub := range filter.And {
+		p, err := compileFilter(sub, columns, missing, unknown)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+
+	if filter.Or != nil {
+		var alts anyOf
+		for _, sub := range filter.Or {
+			p, err := compileFilter(sub, columns, missing, unknown)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, p)
+		}
+		preds = append(preds, alts)
+	}
+
+	if filter.Not != nil {
+		p, err := compileFilter(*filter.Not, columns, missing != unknown, unknown)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, noneOf{p})
+	}
+
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return preds, nil
+}
+
+func compileCondition(field, cond string, columns []common.TableColumn, missing bool) (Predicate, error) {
+	if field == "id" {
+		test, err := compileOperation(cond, common.NumberColumn)
+		if err != nil {
+			return nil, err
+		}
+		return idCondition{test}, nil
+	}
+
+	for _, col := range columns {
+		if col.Name != field {
+			continue
+		}
+		test, err := compileOperation(cond, col.Type)
+		if err != nil {
+			return nil, err
+		}
+		return columnCondition{col.Id, test, missing}, nil
+	}
+	return nil, fmt.Errorf("%s: %s", field, common.ResponseStrings["C2"])
+}
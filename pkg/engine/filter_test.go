@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func searchDocument(t *testing.T, doc string) ([]common.Row[string], error) {
+	var filter common.FilterExpr
+	if err := json.Unmarshal([]byte(doc), &filter); err != nil {
+		t.Fatal(err)
+	}
+	return SearchInTx(common.Default, nil, 0, filter)
+}
+
+func TestFilterGroups(t *testing.T) {
+	config()
+	for doc, expected := range map[string][]common.Row[string]{
+		`{"$or": [{"name": ["=none"]}, {"age": [">50"]}]}`: {
+			newRow(0, "none", 0), newRow(1, "null", 100),
+		},
+		`{"$not": {"name": ["<no"]}}`: {
+			newRow(1, "null", 100),
+		},
+		`{"name": ["<n"], "$not": {"$or": [{"id": ["=0"]}, {"age": ["<10"]}, {"age": [">99"]}]}}`: {
+			newRow(2, "noname", 42),
+		},
+		`{"$and": [{"$or": [{"age": ["=0"]}, {"age": ["=42"]}]}, {"$or": [{"name": [">e"]}]}]}`: {
+			newRow(0, "none", 0), newRow(2, "noname", 42),
+		},
+		`{"$or": []}`: {},
+	} {
+		rows, err := searchDocument(t, doc)
+		if err != nil {
+			t.Fatalf("%s: %s", doc, err)
+		}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Fatalf("%s: expected: %+v, but returned %+v", doc, expected, rows)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	config()
+	if _, err := searchDocument(t, `{"$or": [{"nmae": ["=none"]}]}`); err == nil {
+		t.Fatal("expected an unknown column to be rejected")
+	}
+	if _, err := searchDocument(t, `{"$not": {"age": [".4"]}}`); err == nil {
+		t.Fatal("expected a wrong condition to be rejected")
+	}
+
+	var filter common.FilterExpr
+	if err := json.Unmarshal([]byte(`{"$xor": []}`), &filter); err == nil {
+		t.Fatal("expected an unknown operator to be rejected")
+	}
+}
+
+func TestFilterJSON(t *testing.T) {
+	doc := `{"$not":{"$or":[{"age":[">1"]},{"id":["=2"]}]},"name":["<a","!b"]}`
+	var filter common.FilterExpr
+	if err := json.Unmarshal([]byte(doc), &filter); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded common.FilterExpr
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, filter) {
+		t.Fatalf("expected: %+v, but returned %+v", filter, decoded)
+	}
+}
@@ -0,0 +1,227 @@
+// Package engine searches, aggregates, exports and imports the rows of a
+// database. It knows nothing about HTTP, so both the api handlers and the
+// embedded curiodb package are built on it.
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func SearchForRecords(db *common.DB, tid common.TableIdType, filter common.FilterType) ([]common.Row[string], error) {
+	return SearchInTx(db, nil, tid, common.Where(filter))
+}
+
+// SearchInTx searches the table as seen by the transaction, or the committed
+// table if there is no transaction.
+func SearchInTx(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr) ([]common.Row[string], error) {
+	var rows []common.Row[string]
+	err := findRows(db, tx, tid, filter, func(tableRows []common.Row[common.ColumnIdType], columns []common.TableColumn, pred Predicate) error {
+		rows = searchRows(tableRows, columns, pred, nil)
+		return nil
+	})
+	return rows, err
+}
+
+// FilterError tells that the rows to change couldn't be searched for, the
+// filter doesn't fit the table.
+type FilterError struct {
+	err error
+}
+
+func (e *FilterError) Error() string { return e.err.Error() }
+func (e *FilterError) Unwrap() error { return e.err }
+
+// matchRows finds the ids of the committed rows matching the filter, the
+// caller holds the lock of the table.
+func matchRows(table *common.Table, meta *common.TableMetaData, filter common.FilterExpr) ([]common.RowIdType, error) {
+	pred, err := CompileFilter(filter, meta.Columns)
+	if err != nil {
+		return nil, err
+	}
+	rows, _, ok := lookupRows(table, meta, filter, nil)
+	if !ok {
+		rows = table.Rows
+	}
+	ids := []common.RowIdType{}
+	for _, row := range rows {
+		if !row.Deleted && pred.Match(row) {
+			ids = append(ids, row.Id)
+		}
+	}
+	return ids, nil
+}
+
+// UpdateInTx updates the rows matching the filter as seen by the
+// transaction, or the committed rows if there is none, and returns their
+// ids. Committed rows are matched and updated at once, a row changed by
+// someone else meanwhile is matched as it is then. Failed lists the rows
+// which made the update abort.
+func UpdateInTx(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr, diff map[common.ColumnIdType]interface{}) (ids []common.RowIdType, failed []common.RowIdType, err error) {
+	if tx == nil {
+		return db.UpdateMatching(tid, func(table *common.Table, meta *common.TableMetaData) ([]common.RowIdType, error) {
+			ids, err := matchRows(table, meta, filter)
+			if err != nil {
+				return nil, &FilterError{err}
+			}
+			return ids, nil
+		}, diff)
+	}
+	rows, err := SearchInTx(db, tx, tid, filter)
+	if err != nil {
+		return nil, nil, &FilterError{err}
+	}
+	ids = rowIds(rows)
+	failed, err = tx.UpdateRows(tid, ids, diff)
+	return ids, failed, err
+}
+
+// DeleteInTx deletes the rows matching the filter the same way UpdateInTx
+// updates them.
+func DeleteInTx(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr) (ids []common.RowIdType, failed []common.RowIdType, err error) {
+	if tx == nil {
+		return db.DeleteMatching(tid, func(table *common.Table, meta *common.TableMetaData) ([]common.RowIdType, error) {
+			ids, err := matchRows(table, meta, filter)
+			if err != nil {
+				return nil, &FilterError{err}
+			}
+			return ids, nil
+		})
+	}
+	rows, err := SearchInTx(db, tx, tid, filter)
+	if err != nil {
+		return nil, nil, &FilterError{err}
+	}
+	ids = rowIds(rows)
+	failed, err = tx.DeleteRows(tid, ids)
+	return ids, failed, err
+}
+
+// KeyFilter adds the condition that the primary key of the table equals
+// key to the filter, a nil key leaves the filter as it is. The condition is
+// an in list so that the key is converted as a value of a row is.
+func KeyFilter(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr, key any) (common.FilterExpr, error) {
+	if key == nil {
+		return filter, nil
+	}
+
+	var pk common.TableColumn
+	var err error
+	if tx != nil {
+		err = tx.ReadTable(tid, func(_ []common.Row[common.ColumnIdType], columns []common.TableColumn) error {
+			pk, err = common.PrimaryKeyOf(columns)
+			return err
+		})
+	} else {
+		pk, err = db.PrimaryKey(tid)
+	}
+	if err != nil {
+		return filter, err
+	}
+
+	operand, err := json.Marshal([]any{key})
+	if err != nil {
+		return filter, err
+	}
+	cond := common.Where(common.FilterType{pk.Name: {InOperator + string(operand)}})
+	return common.FilterExpr{And: []common.FilterExpr{filter, cond}}, nil
+}
+
+// UpsertKey finds the column rows are upserted on, the primary key when no
+// name is given.
+func UpsertKey(db *common.DB, tx *common.Tx, tid common.TableIdType, name string) (common.ColumnIdType, error) {
+	var col common.TableColumn
+	var err error
+	find := func(columns []common.TableColumn) error {
+		if name == "" {
+			col, err = common.PrimaryKeyOf(columns)
+			return err
+		}
+		for _, c := range columns {
+			if c.Name == name {
+				col = c
+				return nil
+			}
+		}
+		return fmt.Errorf(common.ResponseStrings["C2"])
+	}
+	if tx != nil {
+		err = tx.ReadTable(tid, func(_ []common.Row[common.ColumnIdType], columns []common.TableColumn) error {
+			return find(columns)
+		})
+	} else {
+		err = db.ReadTable(tid, func(_ *common.Table, meta *common.TableMetaData) error {
+			return find(meta.Columns)
+		})
+	}
+	return col.Id, err
+}
+
+// findRows compiles the filter and runs fn with the rows of the table which
+// may match it and the predicate to tell. The committed table is narrowed
+// down with an index when the filter allows it, the rows a transaction sees
+// are always scanned.
+func findRows(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr, fn func([]common.Row[common.ColumnIdType], []common.TableColumn, Predicate) error) error {
+	return findSortedRows(db, tx, tid, filter, nil, func(rows []common.Row[common.ColumnIdType], columns []common.TableColumn, pred Predicate, _ bool) error {
+		return fn(rows, columns, pred)
+	})
+}
+
+// findSortedRows is findRows for rows that are going to be sorted, fn is
+// told whether they already are because an ordered index was used.
+func findSortedRows(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr, keys []common.SortKey, fn func([]common.Row[common.ColumnIdType], []common.TableColumn, Predicate, bool) error) error {
+	if tx != nil {
+		return tx.ReadTable(tid, func(rows []common.Row[common.ColumnIdType], columns []common.TableColumn) error {
+			pred, err := CompileFilter(filter, columns)
+			if err != nil {
+				return err
+			}
+			return fn(rows, columns, pred, false)
+		})
+	}
+	return db.ReadTable(tid, func(table *common.Table, meta *common.TableMetaData) error {
+		pred, err := CompileFilter(filter, meta.Columns)
+		if err != nil {
+			return err
+		}
+		rows, sorted, ok := lookupRows(table, meta, filter, keys)
+		if !ok {
+			rows = table.Rows
+		}
+		return fn(rows, meta.Columns, pred, sorted)
+	})
+}
+
+// searchRows copies the rows matching the predicate, only the columns of
+// the projection are copied.
+func searchRows(tableRows []common.Row[common.ColumnIdType], columnsMeta []common.TableColumn, pred Predicate, proj Projection) []common.Row[string] {
+	rows := []common.Row[string]{}
+	for _, row := range tableRows {
+		if row.Deleted || !pred.Match(row) {
+			continue
+		}
+
+		var cols = make(map[string]interface{})
+		for colid, val := range row.Columns {
+			if proj.includes(colid) {
+				cols[columnsMeta[colid].Name] = val
+			}
+		}
+
+		rows = append(rows, common.Row[string]{
+			Id:      row.Id,
+			Columns: cols,
+		})
+	}
+	return rows
+}
+
+func rowIds(rows []common.Row[string]) []common.RowIdType {
+	ids := make([]common.RowIdType, len(rows))
+	for i, row := range rows {
+		ids[i] = row.Id
+	}
+	return ids
+}
@@ -1,4 +1,4 @@
-package api
+package engine
 
 import (
 	"reflect"
@@ -18,7 +18,7 @@ func newRow(id common.RowIdType, name string, age int) common.Row[string] {
 }
 
 func config() {
-	common.Config(common.DatabaseStore{
+	common.Default.Config(common.DatabaseStore{
 		Tables: []common.Table{{
 			Id:   0,
 			Rows: make([]common.Row[common.ColumnIdType], 0),
@@ -36,7 +36,7 @@ func config() {
 		{"noname", 42},
 	}
 	for _, cols := range defaultRows {
-		common.AddNewRow(0, map[common.ColumnIdType]interface{}{
+		common.Default.AddNewRow(0, map[common.ColumnIdType]interface{}{
 			0: cols[0],
 			1: cols[1],
 		})
@@ -45,7 +45,7 @@ func config() {
 
 func TestSearchForRecordsEqual(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"name": {"=none"},
 	})
 	if err != nil {
@@ -61,7 +61,7 @@ func TestSearchForRecordsEqual(t *testing.T) {
 
 func TestSearchForRecordsStartsWith(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"name": {"<no"},
 	})
 	if err != nil {
@@ -77,7 +77,7 @@ func TestSearchForRecordsStartsWith(t *testing.T) {
 
 func TestSearchForRecordsContains(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"name": {".l"},
 	})
 	if err != nil {
@@ -93,7 +93,7 @@ func TestSearchForRecordsContains(t *testing.T) {
 
 func TestSearchForRecordsNot(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"name": {"!null"},
 	})
 	if err != nil {
@@ -110,7 +110,7 @@ func TestSearchForRecordsNot(t *testing.T) {
 
 func TestSearchForRecordsMultiple(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"name": {"<n", ">me"},
 	})
 	if err != nil {
@@ -126,7 +126,7 @@ func TestSearchForRecordsMultiple(t *testing.T) {
 
 func TestSearchForRecordsMultiField(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"name": {">e"},
 		"age":  {"!42"},
 	})
@@ -143,7 +143,7 @@ func TestSearchForRecordsMultiField(t *testing.T) {
 
 func TestSearchForRecordsById(t *testing.T) {
 	config()
-	rows, err := SearchForRecords(0, common.FilterType{
+	rows, err := SearchForRecords(common.Default, 0, common.FilterType{
 		"id": {"=1"},
 	})
 	if err != nil {
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// lookupRows narrows the rows of the table down to the ones an index says
+// may match the filter. Only conditions every match must meet are looked
+// at, i.e. not the ones under $or or $not. When the rows are to be sorted
+// and an ordered index is on the sort columns, the rows come in the sort
+// order if that index is used, sorted tells. It returns false when no index
+// applies.
+func lookupRows(table *common.Table, meta *common.TableMetaData, filter common.FilterExpr, keys []common.SortKey) (rows []common.Row[common.ColumnIdType], sorted bool, ok bool) {
+	conds := conjunction(filter, meta.Columns)
+	sortIndex, order := sortingIndex(meta, keys)
+
+	var excluded []hashLookup
+	for i, index := range meta.Indexes {
+		var found []common.Row[common.ColumnIdType]
+		var used bool
+
+		if index.Kind == common.HashIndex {
+			lookup, applies := hashLookupOf(i, conds[index.Columns[0]], meta.Columns[index.Columns[0]].Type)
+			if !applies {
+				continue
+			}
+			if lookup.exclude {
+				excluded = append(excluded, lookup)
+				continue
+			}
+			found, used = table.IndexedRows(i, lookup.values, false)
+		} else {
+			r, applies := keyRangeOf(index.Columns, conds, meta.Columns)
+			if !applies {
+				continue
+			}
+			indexOrder := common.TableOrder
+			if i == sortIndex {
+				indexOrder = order
+			}
+			found, used = table.RangeRows(i, r, indexOrder)
+		}
+
+		// the smaller set of rows wins, ties go to the one in sort order
+		if used && (!ok || len(found) < len(rows) || (len(found) == len(rows) && i == sortIndex)) {
+			rows, sorted, ok = found, i == sortIndex, true
+		}
+	}
+	if ok {
+		return rows, sorted, true
+	}
+
+	if sortIndex >= 0 {
+		rows, ok = table.RangeRows(sortIndex, common.KeyRange{}, order)
+		return rows, ok, ok
+	}
+
+	// a not equal condition still saves checking the rows holding the value
+	for _, lookup := range excluded {
+		if rows, ok := table.IndexedRows(lookup.index, lookup.values, true); ok {
+			return rows, false, true
+		}
+	}
+	return nil, false, false
+}
+
+// conjunction collects the conditions of the filter which every matching row
+// meets, by column.
+func conjunction(filter common.FilterExpr, columns []common.TableColumn) map[common.ColumnIdType][]string {
+	conds := map[common.ColumnIdType][]string{}
+	var collect func(filter common.FilterExpr)
+	collect = func(filter common.FilterExpr) {
+		for field, fieldConds := range filter.Fields {
+			if col, ok := findColumn(columns, field); ok && field != "id" {
+				conds[col.Id] = append(conds[col.Id], fieldConds...)
+			}
+		}
+		for _, sub := range filter.And {
+			collect(sub)
+		}
+	}
+	collect(filter)
+	return conds
+}
+
+// sortingIndex finds the ordered index on exactly the sort columns, rows
+// with the same values are sorted by id in either direction as pages are.
+func sortingIndex(meta *common.TableMetaData, keys []common.SortKey) (int, common.IndexOrder) {
+	if len(keys) == 0 {
+		return -1, common.TableOrder
+	}
+	order := common.KeyOrder
+	if keys[0].Desc {
+		order = common.ReverseKeyOrder
+	}
+
+	for i, index := range meta.Indexes {
+		if index.Kind != common.OrderedIndex || len(index.Columns) != len(keys) {
+			continue
+		}
+		matches := true
+		for j, key := range keys {
+			col, ok := findColumn(meta.Columns, key.Column)
+			if !ok || key.Column == "id" || col.Id != index.Columns[j] || key.Desc != keys[0].Desc {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return i, order
+		}
+	}
+	return -1, common.TableOrder
+}
+
+type hashLookup struct {
+	index   int
+	values  []any
+	exclude bool
+}
+
+// hashLookupOf picks the condition a hash index can serve: =, ! and != or
+// their in and !in lists, an equality is preferred.
+func hashLookupOf(index int, conds []string, typ uint8) (hashLookup, bool) {
+	var found hashLookup
+	ok := false
+	for _, cond := range conds {
+		op, fold, operand, err := parseOperator(cond)
+		if err != nil || fold {
+			continue
+		}
+
+		lookup := hashLookup{index: index}
+		switch op.name {
+		case EqualOperator, NotEqualOperator, NotOperator:
+			val, err := convert(operand, typ)
+			if err != nil {
+				continue
+			}
+			lookup.values, lookup.exclude = []any{val}, op.name != EqualOperator
+		case InOperator, NotInOperator:
+			values, err := convertList(operand, typ)
+			if err != nil {
+				continue
+			}
+			lookup.values, lookup.exclude = values, op.name == NotInOperator
+		default:
+			continue
+		}
+
+		if !ok || (found.exclude && !lookup.exclude) {
+			found, ok = lookup, true
+		}
+	}
+	return found, ok
+}
+
+// keyRangeOf builds the range of an ordered index from the = conditions on
+// its first columns and the range or prefix conditions on the next one.
+func keyRangeOf(indexColumns []common.ColumnIdType, conds map[common.ColumnIdType][]string, columns []common.TableColumn) (common.KeyRange, bool) {
+	var r common.KeyRange
+	for _, id := range indexColumns {
+		typ := columns[id].Type
+		if val, ok := equalValue(conds[id], typ); ok {
+			r.Equal = append(r.Equal, val)
+			continue
+		}
+		for _, cond := range conds[id] {
+			narrowRange(&r, cond, typ)
+		}
+		break
+	}
+	return r, len(r.Equal) > 0 || r.Bounded
+}
+
+func equalValue(conds []string, typ uint8) (any, bool) {
+	for _, cond := range conds {
+		op, fold, operand, err := parseOperator(cond)
+		if err != nil || fold || op.name != EqualOperator {
+			continue
+		}
+		if val, err := convert(operand, typ); err == nil {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// narrowRange bounds the range by the condition when it is a comparison
+// with the values of a number column or a prefix of a string one.
+func narrowRange(r *common.KeyRange, cond string, typ uint8) {
+	op, fold, operand, err := parseOperator(cond)
+	if err != nil || fold {
+		return
+	}
+
+	if typ == common.StringColumn {
+		// for strings < means starts with
+		if (op.name == PrefixOperator || op.name == LessOperator) && !r.Bounded {
+			r.Bounded, r.Prefix, r.Lower = true, true, operand
+		}
+		return
+	}
+
+	lower := func(v any, open bool) {
+		if c := common.CompareValues(v, r.Lower); r.Lower == nil || c > 0 || (c == 0 && open) {
+			r.Lower, r.LowerOpen = v, open
+		}
+		r.Bounded = true
+	}
+	upper := func(v any, open bool) {
+		if c := common.CompareValues(v, r.Upper); r.Upper == nil || c < 0 || (c == 0 && open) {
+			r.Upper, r.UpperOpen = v, open
+		}
+		r.Bounded = true
+	}
+
+	if op.name == BetweenOperator {
+		values, err := convertList(operand, typ)
+		if err == nil && len(values) == 2 {
+			lower(values[0], false)
+			upper(values[1], false)
+		}
+		return
+	}
+	val, err := convert(operand, typ)
+	if err != nil {
+		return
+	}
+	switch op.name {
+	case LessOperator:
+		upper(val, true)
+	case LessEqualOperator:
+		upper(val, false)
+	case GreaterOperator:
+		lower(val, true)
+	case GreaterEqualOperator:
+		lower(val, false)
+	}
+}
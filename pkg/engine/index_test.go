@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func index(kind uint8, columns ...common.ColumnIdType) common.TableIndex {
+	return common.TableIndex{Kind: kind, Columns: columns}
+}
+
+func TestSearchWithIndex(t *testing.T) {
+	docs := []string{
+		`{"name": ["=none"]}`,
+		`{"name": ["in[\"null\",\"none\",\"none\"]"], "age": [">0"]}`,
+		`{"name": ["!none"]}`,
+		`{"name": ["!in[\"none\",\"null\"]"]}`,
+		`{"$and": [{"age": ["=42"]}, {"name": ["=noname"]}]}`,
+		`{"$or": [{"age": ["=42"]}, {"name": ["=none"]}]}`,
+		`{"name": ["i=NONE"]}`,
+		`{"age": [">0", "<=42"]}`,
+		`{"age": ["between[0,50]", ">=0", "<100"]}`,
+		`{"name": ["^=no"], "age": ["<100"]}`,
+		`{"name": ["<nu"]}`,
+		`{"name": ["=none"], "age": [">=0"]}`,
+	}
+	indexes := [][]common.TableIndex{
+		{index(common.HashIndex, 0), index(common.HashIndex, 1)},
+		{index(common.OrderedIndex, 1), index(common.OrderedIndex, 0)},
+		{index(common.OrderedIndex, 0, 1)},
+	}
+
+	config()
+	var expected [][]common.Row[string]
+	for _, doc := range docs {
+		rows, err := searchDocument(t, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, rows)
+	}
+
+	for _, set := range indexes {
+		config()
+		for _, idx := range set {
+			if err := common.Default.CreateIndex(0, idx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, doc := range docs {
+			rows, err := searchDocument(t, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, expected[i]) {
+				t.Fatalf("%+v %s: expected: %+v, but returned %+v", set, doc, expected[i], rows)
+			}
+		}
+	}
+}
+
+func TestSearchWithIndexMissingValues(t *testing.T) {
+	config()
+	nick, err := common.Default.CreateNewColumn(0, "nick", common.StringColumn, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []uint8{common.HashIndex, common.OrderedIndex} {
+		if err := common.Default.CreateIndex(0, index(kind, nick)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := common.Default.UpdateRow(0, 1, map[common.ColumnIdType]interface{}{nick: "nil"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// rows without a nick match as they do without the index
+	for _, cond := range []string{"=nobody", "^=nobody"} {
+		rows, err := SearchForRecords(common.Default, 0, common.FilterType{"nick": {cond}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := rowIds(rows); !reflect.DeepEqual(ids, []common.RowIdType{0, 2}) {
+			t.Fatalf("%s: expected: [0 2], but returned %v", cond, ids)
+		}
+	}
+}
+
+func TestPageSortWithIndex(t *testing.T) {
+	config()
+	for _, row := range [][2]any{{"none", 42}, {"abc", 7}} {
+		common.Default.AddNewRow(0, map[common.ColumnIdType]interface{}{0: row[0], 1: row[1]})
+	}
+	pages := []common.Page{
+		{Sort: []common.SortKey{{Column: "name"}, {Column: "age"}}},
+		{Sort: []common.SortKey{{Column: "name", Desc: true}, {Column: "age", Desc: true}}, Limit: 3},
+		{Sort: []common.SortKey{{Column: "age", Desc: true}}},
+	}
+	var expected []RowPage
+	for _, page := range pages {
+		expected = append(expected, searchPage(t, page))
+	}
+
+	for _, idx := range []common.TableIndex{index(common.OrderedIndex, 0, 1), index(common.OrderedIndex, 1)} {
+		if err := common.Default.CreateIndex(0, idx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, page := range pages {
+		if result := searchPage(t, page); !reflect.DeepEqual(result, expected[i]) {
+			t.Fatalf("%+v: expected: %+v, but returned %+v", page, expected[i], result)
+		}
+		next := page
+		next.Cursor = expected[i].Next
+		if next.Cursor != "" && !reflect.DeepEqual(searchPage(t, next).Rows, searchPage(t, common.Page{Sort: page.Sort}).Rows[3:]) {
+			t.Fatalf("%+v: expected the next page to start after the first one", page)
+		}
+	}
+
+	var sorted bool
+	err := common.Default.ReadTable(0, func(table *common.Table, meta *common.TableMetaData) error {
+		_, sorted, _ = lookupRows(table, meta, common.FilterExpr{}, pages[2].Sort)
+		return nil
+	})
+	if err != nil || !sorted {
+		t.Fatalf("expected the rows to be sorted by the index, but returned %v, %v", sorted, err)
+	}
+}
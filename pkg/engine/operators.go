@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// Operators of filter conditions, a condition is an operator followed by
+// its operand: "=alice", ">=18", "^=al", "in[1,2,3]", "between[18,65]".
+// Operators marked foldable have a case-insensitive variant prefixed with
+// FOLD_PREFIX, e.g. "i=alice".
+const (
+	EqualOperator        = "="
+	NotEqualOperator     = "!="
+	NotOperator          = "!" // same as !=
+	LessOperator         = "<" // starts with, for strings
+	LessEqualOperator    = "<="
+	GreaterOperator      = ">" // ends with, for strings
+	GreaterEqualOperator = ">="
+	PrefixOperator       = "^="
+	SuffixOperator       = "$="
+	ContainOperator      = "*="
+	DotContainOperator   = "." // same as *=
+	InOperator           = "in"
+	NotInOperator        = "!in"
+	BetweenOperator      = "between"
+	MatchOperator        = "~"
+	NotMatchOperator     = "!~"
+	MatchFoldOperator    = "~*"
+	NotMatchFoldOperator = "!~*"
+
+	FOLD_PREFIX = "i"
+)
+
+const REGEX_CACHE_SIZE = 256
+
+type operandKind uint8
+
+const (
+	valueOperand   operandKind = iota // a single value
+	listOperand                       // a JSON array of values
+	rangeOperand                      // a JSON array of two numbers
+	patternOperand                    // a regular expression
+)
+
+type operator struct {
+	name     string
+	operand  operandKind
+	types    []uint8 // column types it applies to
+	foldable bool
+}
+
+var (
+	anyType    = []uint8{common.NumberColumn, common.StringColumn, common.BoolColumn}
+	numberType = []uint8{common.NumberColumn}
+	stringType = []uint8{common.StringColumn}
+	ordered    = []uint8{common.NumberColumn, common.StringColumn}
+)
+
+// operators are listed so that no operator comes after one it starts with
+var operators = []operator{
+	{NotInOperator, listOperand, anyType, true},
+	{InOperator, listOperand, anyType, true},
+	{BetweenOperator, rangeOperand, numberType, false},
+	{NotMatchFoldOperator, patternOperand, stringType, false},
+	{NotMatchOperator, patternOperand, stringType, false},
+	{MatchFoldOperator, patternOperand, stringType, false},
+	{MatchOperator, patternOperand, stringType, false},
+	{NotEqualOperator, valueOperand, anyType, true},
+	{LessEqualOperator, valueOperand, numberType, false},
+	{GreaterEqualOperator, valueOperand, numberType, false},
+	{PrefixOperator, valueOperand, stringType, true},
+	{SuffixOperator, valueOperand, stringType, true},
+	{ContainOperator, valueOperand, stringType, true},
+	{EqualOperator, valueOperand, anyType, true},
+	{NotOperator, valueOperand, anyType, true},
+	{LessOperator, valueOperand, ordered, false},
+	{GreaterOperator, valueOperand, ordered, false},
+	{DotContainOperator, valueOperand, stringType, true},
+}
+
+// parseOperator splits a condition into its operator and operand.
+func parseOperator(cond string) (*operator, bool, string, error) {
+	for _, fold := range []bool{false, true} {
+		rest := cond
+		if fold {
+			if !strings.HasPrefix(cond, FOLD_PREFIX) {
+				break
+			}
+			rest = cond[len(FOLD_PREFIX):]
+		}
+		for i := range operators {
+			op := &operators[i]
+			if !strings.HasPrefix(rest, op.name) || (fold && !op.foldable) {
+				continue
+			}
+			operand := rest[len(op.name):]
+			// word operators are followed by their JSON operand
+			if (op.operand == listOperand || op.operand == rangeOperand) && !strings.HasPrefix(operand, "[") {
+				continue
+			}
+			return op, fold, operand, nil
+		}
+	}
+	return nil, false, "", fmt.Errorf("wrong condition %q", cond)
+}
+
+// compileOperation builds the test of a condition on values of a column of
+// the given type.
+func compileOperation(cond string, typ uint8) (func(any) bool, error) {
+	op, fold, operand, err := parseOperator(cond)
+	if err != nil {
+		return nil, err
+	}
+	if !supports(op, typ) {
+		return nil, fmt.Errorf("wrong condition %q: %s is not supported for %s columns",
+			cond, op.name, common.ColumnsTypeEnum[typ])
+	}
+	if fold && typ != common.StringColumn {
+		return nil, fmt.Errorf("wrong condition %q: case-insensitive operators are for strings", cond)
+	}
+
+	switch op.operand {
+	case listOperand:
+		values, err := convertList(operand, typ)
+		if err != nil {
+			return nil, err
+		}
+		if fold {
+			for i, v := range values {
+				values[i] = strings.ToLower(v.(string))
+			}
+		}
+		in := op.name == InOperator
+		return func(a any) bool {
+			if fold {
+				if s, ok := a.(string); ok {
+					a = strings.ToLower(s)
+				}
+			}
+			for _, v := range values {
+				if a == v {
+					return in
+				}
+			}
+			return !in
+		}, nil
+
+	case rangeOperand:
+		values, err := convertList(operand, typ)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 2 {
+			return nil, fmt.Errorf("wrong condition %q: between takes two values", cond)
+		}
+		lo, hi := values[0].(float64), values[1].(float64)
+		return func(a any) bool {
+			v := a.(float64)
+			return v >= lo && v <= hi
+		}, nil
+
+	case patternOperand:
+		pattern := operand
+		if op.name == MatchFoldOperator || op.name == NotMatchFoldOperator {
+			pattern = "(?i)" + pattern
+		}
+		re, err := compileRegex(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("wrong condition %q: %s", cond, err)
+		}
+		match := op.name == MatchOperator || op.name == MatchFoldOperator
+		return func(a any) bool {
+			return re.MatchString(a.(string)) == match
+		}, nil
+	}
+
+	b, err := convert(operand, typ)
+	if err != nil {
+		return nil, err
+	}
+	if fold {
+		return compileFolded(op.name, strings.ToLower(b.(string))), nil
+	}
+	return compileComparison(op.name, typ, b), nil
+}
+
+func supports(op *operator, typ uint8) bool {
+	return typeIn(typ, op.types)
+}
+
+func typeIn(typ uint8, types []uint8) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func compileComparison(op string, typ uint8, b any) func(any) bool {
+	switch op {
+	case EqualOperator:
+		return func(a any) bool { return a == b }
+	case NotEqualOperator, NotOperator:
+		return func(a any) bool { return a != b }
+	case LessOperator:
+		if typ == common.StringColumn {
+			return func(a any) bool { return strings.HasPrefix(a.(string), b.(string)) }
+		}
+		return func(a any) bool { return a.(float64) < b.(float64) }
+	case LessEqualOperator:
+		return func(a any) bool { return a.(float64) <= b.(float64) }
+	case GreaterOperator:
+		if typ == common.StringColumn {
+			return func(a any) bool { return strings.HasSuffix(a.(string), b.(string)) }
+		}
+		return func(a any) bool { return a.(float64) > b.(float64) }
+	case GreaterEqualOperator:
+		return func(a any) bool { return a.(float64) >= b.(float64) }
+	case PrefixOperator:
+		return func(a any) bool { return strings.HasPrefix(a.(string), b.(string)) }
+	case SuffixOperator:
+		return func(a any) bool { return strings.HasSuffix(a.(string), b.(string)) }
+	}
+	// ContainOperator and DotContainOperator
+	return func(a any) bool { return strings.Contains(a.(string), b.(string)) }
+}
+
+// compileFolded compares strings ignoring case, b is already lower case.
+func compileFolded(op string, b string) func(any) bool {
+	test := compileComparison(op, common.StringColumn, b)
+	return func(a any) bool {
+		return test(strings.ToLower(a.(string)))
+	}
+}
+
+func convert(cond string, typeId uint8) (any, error) {
+	var val any
+	var err error
+	if typeId == 0 {
+		val, err = strconv.ParseFloat(cond, 64)
+		if err != nil {
+			return nil, errors.New("wrong number")
+		}
+	} else if typeId == 1 {
+		val = cond
+	} else if typeId == 2 {
+		if cond == "false" {
+			val = false
+		} else if cond == "true" {
+			val = true
+		} else {
+			return nil, errors.New("only true and false are allowed")
+		}
+	}
+	return val, err
+}
+
+// convertList decodes the JSON array operand of a condition.
+func convertList(operand string, typ uint8) ([]any, error) {
+	var raw []any
+	if err := json.Unmarshal([]byte(operand), &raw); err != nil {
+		return nil, fmt.Errorf("wrong list %s", operand)
+	}
+	values := make([]any, len(raw))
+	for i, v := range raw {
+		val, err := common.ConvertValue(v, typ)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+// compiled regular expressions by pattern, the cache is emptied when it is
+// full rather than tracking which ones are used
+var regexCache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: map[string]*regexp.Regexp{}}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if re, ok := regexCache.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexCache.patterns) >= REGEX_CACHE_SIZE {
+		regexCache.patterns = map[string]*regexp.Regexp{}
+	}
+	regexCache.patterns[pattern] = re
+	return re, nil
+}
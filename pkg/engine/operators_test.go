@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func TestOperators(t *testing.T) {
+	config()
+	for _, c := range []struct {
+		field, cond string
+		expected    []common.RowIdType
+	}{
+		{"age", ">=42", []common.RowIdType{1, 2}},
+		{"age", "<=42", []common.RowIdType{0, 2}},
+		{"age", "between[1,99]", []common.RowIdType{2}},
+		{"age", "in[0,100]", []common.RowIdType{0, 1}},
+		{"age", "!in[0,100]", []common.RowIdType{2}},
+		{"id", "in[2]", []common.RowIdType{2}},
+		{"id", ">=1", []common.RowIdType{1, 2}},
+		{"name", "^=no", []common.RowIdType{0, 2}},
+		{"name", "$=ll", []common.RowIdType{1}},
+		{"name", "*=nam", []common.RowIdType{2}},
+		{"name", "!=null", []common.RowIdType{0, 2}},
+		{"name", "i=NULL", []common.RowIdType{1}},
+		{"name", "i!=NONE", []common.RowIdType{1, 2}},
+		{"name", "i^=NO", []common.RowIdType{0, 2}},
+		{"name", "iin[\"NONE\",\"Null\"]", []common.RowIdType{0, 1}},
+		{"name", "in[\"none\",\"nothing\"]", []common.RowIdType{0}},
+		{"name", "~^n.n", []common.RowIdType{0, 2}},
+		{"name", "!~^n.n", []common.RowIdType{1}},
+		{"name", "~*^NU", []common.RowIdType{1}},
+		{"name", "!~*E$", []common.RowIdType{1}},
+		{"name", "=in[1]", []common.RowIdType{}},
+	} {
+		rows, err := SearchForRecords(common.Default, 0, common.FilterType{c.field: {c.cond}})
+		if err != nil {
+			t.Fatalf("%s %s: %s", c.field, c.cond, err)
+		}
+		ids := rowIds(rows)
+		if !reflect.DeepEqual(ids, c.expected) {
+			t.Fatalf("%s %s: expected: %+v, but returned %+v", c.field, c.cond, c.expected, ids)
+		}
+	}
+}
+
+func TestOperatorTypes(t *testing.T) {
+	config()
+	for field, cond := range map[string]string{
+		"age":  "^=4",
+		"name": ">=a",
+		"id":   "~1",
+	} {
+		if _, err := SearchForRecords(common.Default, 0, common.FilterType{field: {cond}}); err == nil {
+			t.Fatalf("expected %s %s to be rejected", field, cond)
+		}
+	}
+	for _, cond := range []string{"i>4", "between[1]", "in[\"a\"]", "in 1", "?1", ""} {
+		if _, err := SearchForRecords(common.Default, 0, common.FilterType{"age": {cond}}); err == nil {
+			t.Fatalf("expected age %q to be rejected", cond)
+		}
+	}
+	if _, err := SearchForRecords(common.Default, 0, common.FilterType{"name": {"~("}}); err == nil {
+		t.Fatal("expected a bad pattern to be rejected")
+	}
+}
+
+func TestRegexCache(t *testing.T) {
+	first, err := compileRegex("^a+$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := compileRegex("^a+$")
+	if first != second {
+		t.Fatal("expected the compiled pattern to be reused")
+	}
+}
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+var ErrWrongCursor = errors.New("wrong cursor")
+
+// RowPage is a page of found rows, Next is the cursor of the following page
+// and is empty on the last one.
+type RowPage struct {
+	Rows  []common.Row[string] `json:"rows"`
+	Next  string               `json:"next,omitempty"`
+	Total *int                 `json:"total,omitempty"`
+}
+
+// cursor points after the last row of a page by its sort values and id, a
+// page starts after it wherever rows were inserted or deleted meanwhile.
+type cursor struct {
+	Sort   []common.SortKey `json:"s"`
+	Values []any            `json:"v"`
+	Id     common.RowIdType `json:"id"`
+}
+
+// Paged tells whether the rows are sent in pages rather than all at once.
+func Paged(page common.Page) bool {
+	return page.Limit > 0 || page.Cursor != "" || page.Total
+}
+
+// SearchPage searches the table like SearchInTx, then sorts the found rows
+// and cuts the page out of them. Only the fields of the projection are
+// copied from the table, see CompileProjection.
+func SearchPage(db *common.DB, tx *common.Tx, tid common.TableIdType, filter common.FilterExpr, page common.Page, fields []string) (RowPage, error) {
+	if page.Limit < 0 || page.Offset < 0 {
+		return RowPage{}, errors.New("limit and offset must not be negative")
+	}
+
+	var rows []common.Row[string]
+	var sortOnly []string // columns copied to sort by but not projected
+	sorted := false
+	err := findSortedRows(db, tx, tid, filter, page.Sort, func(tableRows []common.Row[common.ColumnIdType], columns []common.TableColumn, pred Predicate, inOrder bool) error {
+		proj, err := CompileProjection(fields, columns)
+		if err != nil {
+			return err
+		}
+		var sortColumns []string
+		for _, key := range page.Sort {
+			col, ok := findColumn(columns, key.Column)
+			if !ok {
+				return fmt.Errorf("%s: %s", key.Column, common.ResponseStrings["C2"])
+			}
+			if key.Column != "id" && !proj.includes(col.Id) {
+				sortOnly = append(sortOnly, col.Name)
+			}
+			sortColumns = append(sortColumns, col.Name)
+		}
+		rows = searchRows(tableRows, columns, pred, proj.with(sortColumns, columns))
+		sorted = inOrder
+		return nil
+	})
+	if err != nil {
+		return RowPage{}, err
+	}
+
+	result := RowPage{}
+	if page.Total {
+		total := len(rows)
+		result.Total = &total
+	}
+
+	if !sorted {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return compareRows(page.Sort, sortValues(page.Sort, rows[i]), rows[i].Id, sortValues(page.Sort, rows[j]), rows[j].Id) < 0
+		})
+	}
+
+	if page.Cursor != "" {
+		after, err := decodeCursor(page.Cursor, page.Sort)
+		if err != nil {
+			return RowPage{}, err
+		}
+		start := sort.Search(len(rows), func(i int) bool {
+			return compareRows(page.Sort, sortValues(page.Sort, rows[i]), rows[i].Id, after.Values, after.Id) > 0
+		})
+		rows = rows[start:]
+	}
+
+	if page.Offset >= len(rows) {
+		rows = rows[:0]
+	} else {
+		rows = rows[page.Offset:]
+	}
+	if page.Limit > 0 && page.Limit < len(rows) {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		result.Next = encodeCursor(cursor{page.Sort, sortValues(page.Sort, last), last.Id})
+	}
+	for _, row := range rows {
+		for _, name := range sortOnly {
+			delete(row.Columns, name)
+		}
+	}
+	result.Rows = rows
+	return result, nil
+}
+
+func findColumn(columns []common.TableColumn, name string) (common.TableColumn, bool) {
+	if name == "id" {
+		return common.TableColumn{Name: name}, true
+	}
+	for _, col := range columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return common.TableColumn{}, false
+}
+
+func sortValues(keys []common.SortKey, row common.Row[string]) []any {
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		if key.Column == "id" {
+			values[i] = float64(row.Id)
+		} else {
+			values[i] = row.Columns[key.Column]
+		}
+	}
+	return values
+}
+
+// compareRows orders rows by the sort keys then by id, so that the order is
+// total and a cursor is never ambiguous.
+func compareRows(keys []common.SortKey, a []any, aid common.RowIdType, b []any, bid common.RowIdType) int {
+	for i, key := range keys {
+		c := common.CompareValues(a[i], b[i])
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	switch {
+	case aid < bid:
+		return -1
+	case aid > bid:
+		return 1
+	}
+	return 0
+}
+
+func encodeCursor(c cursor) string {
+	content, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// decodeCursor reads a cursor given back by a client, it must have been made
+// for the same sort.
+func decodeCursor(text string, keys []common.SortKey) (cursor, error) {
+	var c cursor
+	content, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return c, ErrWrongCursor
+	}
+	if err := json.Unmarshal(content, &c); err != nil || len(c.Values) != len(c.Sort) {
+		return c, ErrWrongCursor
+	}
+	if len(c.Sort) != len(keys) || (len(keys) > 0 && !reflect.DeepEqual(c.Sort, keys)) {
+		return c, fmt.Errorf("%w: it was made for another sort", ErrWrongCursor)
+	}
+	return c, nil
+}
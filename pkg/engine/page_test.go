@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func searchPage(t *testing.T, page common.Page) RowPage {
+	result, err := SearchPage(common.Default, nil, 0, common.FilterExpr{}, page, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestPageSort(t *testing.T) {
+	config()
+	common.Default.AddNewRow(0, map[common.ColumnIdType]interface{}{0: "none", 1: 7.0})
+
+	result := searchPage(t, common.Page{Sort: []common.SortKey{{Column: "name"}, {Column: "age", Desc: true}}})
+	expected := []common.RowIdType{2, 3, 0, 1}
+	if ids := rowIds(result.Rows); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, ids)
+	}
+
+	result = searchPage(t, common.Page{Sort: []common.SortKey{{Column: "id", Desc: true}}, Offset: 1, Limit: 2})
+	expected = []common.RowIdType{2, 1}
+	if ids := rowIds(result.Rows); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, ids)
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	config()
+	page := common.Page{Sort: []common.SortKey{{Column: "age", Desc: true}}, Limit: 2, Total: true}
+
+	first := searchPage(t, page)
+	if ids := rowIds(first.Rows); !reflect.DeepEqual(ids, []common.RowIdType{1, 2}) || first.Next == "" || *first.Total != 3 {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+
+	// rows inserted before and after the cursor don't shift the next page
+	common.Default.AddNewRow(0, map[common.ColumnIdType]interface{}{0: "early", 1: 50.0})
+	common.Default.AddNewRow(0, map[common.ColumnIdType]interface{}{0: "late", 1: 10.0})
+
+	page.Cursor = first.Next
+	second := searchPage(t, page)
+	if ids := rowIds(second.Rows); !reflect.DeepEqual(ids, []common.RowIdType{4, 0}) || second.Next != "" || *second.Total != 5 {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+}
+
+func TestPageErrors(t *testing.T) {
+	config()
+	for _, page := range []common.Page{
+		{Sort: []common.SortKey{{Column: "nmae"}}},
+		{Limit: -1},
+		{Cursor: "not a cursor"},
+		{Cursor: searchPage(t, common.Page{Limit: 1}).Next, Sort: []common.SortKey{{Column: "age"}}},
+	} {
+		if _, err := SearchPage(common.Default, nil, 0, common.FilterExpr{}, page, nil); err == nil {
+			t.Fatalf("expected %+v to be rejected", page)
+		}
+	}
+
+	_, err := SearchPage(common.Default, nil, 0, common.FilterExpr{}, common.Page{Cursor: "bm90IGpzb24"}, nil)
+	if !errors.Is(err, ErrWrongCursor) {
+		t.Fatalf("expected a wrong cursor error, but returned %v", err)
+	}
+}
+
+func TestPageFields(t *testing.T) {
+	config()
+	sortByAge := []common.SortKey{{Column: "age"}}
+	for _, c := range []struct {
+		fields   []string
+		expected []common.Row[string]
+	}{
+		{[]string{"name"}, []common.Row[string]{
+			{Id: 0, Columns: map[string]any{"name": "none"}},
+			{Id: 2, Columns: map[string]any{"name": "noname"}},
+			{Id: 1, Columns: map[string]any{"name": "null"}},
+		}},
+		{[]string{"-name"}, []common.Row[string]{
+			{Id: 0, Columns: map[string]any{"age": 0.0}},
+			{Id: 2, Columns: map[string]any{"age": 42.0}},
+			{Id: 1, Columns: map[string]any{"age": 100.0}},
+		}},
+		{[]string{"id"}, []common.Row[string]{
+			{Id: 0, Columns: map[string]any{}},
+			{Id: 2, Columns: map[string]any{}},
+			{Id: 1, Columns: map[string]any{}},
+		}},
+	} {
+		result, err := SearchPage(common.Default, nil, 0, common.FilterExpr{}, common.Page{Sort: sortByAge}, c.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Rows, c.expected) {
+			t.Fatalf("%v: expected: %+v, but returned %+v", c.fields, c.expected, result.Rows)
+		}
+	}
+
+	for _, fields := range [][]string{{"name", "-age"}, {"nmae"}} {
+		if _, err := SearchPage(common.Default, nil, 0, common.FilterExpr{}, common.Page{}, fields); err == nil {
+			t.Fatalf("expected %v to be rejected", fields)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// EXCLUDE_PREFIX marks the fields a projection leaves out, e.g. "-bio".
+const EXCLUDE_PREFIX = "-"
+
+// Projection tells by column id which columns a scan copies into the found
+// rows, a nil projection copies them all.
+type Projection []bool
+
+// CompileProjection checks the fields against the columns of the table. The
+// fields either all name the columns to include or all, prefixed with
+// EXCLUDE_PREFIX, the columns to leave out. The row id is always included.
+func CompileProjection(fields []string, columns []common.TableColumn) (Projection, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	exclude := strings.HasPrefix(fields[0], EXCLUDE_PREFIX)
+	proj := make(Projection, len(columns))
+	for i := range proj {
+		proj[i] = exclude
+	}
+	for _, field := range fields {
+		if strings.HasPrefix(field, EXCLUDE_PREFIX) != exclude {
+			return nil, errors.New("fields must either all be included or all be excluded")
+		}
+		name := strings.TrimPrefix(field, EXCLUDE_PREFIX)
+		if name == "id" {
+			continue
+		}
+		col, ok := findColumn(columns, name)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s", name, common.ResponseStrings["C2"])
+		}
+		proj[col.Id] = !exclude
+	}
+	return proj, nil
+}
+
+func (p Projection) includes(col common.ColumnIdType) bool {
+	return p == nil || (int(col) < len(p) && p[col])
+}
+
+// with adds the named columns to the projection.
+func (p Projection) with(names []string, columns []common.TableColumn) Projection {
+	if p == nil {
+		return nil
+	}
+	wider := append(Projection{}, p...)
+	for _, name := range names {
+		if col, ok := findColumn(columns, name); ok && name != "id" {
+			wider[col.Id] = true
+		}
+	}
+	return wider
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// rows inserted with one record of the log unless the request sets batch
+const BULK_BATCH_SIZE = 1000
+const MAX_BULK_BATCH_SIZE = 100000
+
+// RowReader reads rows from a JSON array of objects or from NDJSON, an
+// object per line. A line that can't be decoded fails
+// alone, a broken array ends the stream.
+type RowReader struct {
+	r     *bufio.Reader
+	array *json.Decoder
+	done  bool
+}
+
+func NewRowReader(body io.Reader) (*RowReader, error) {
+	b := &RowReader{r: bufio.NewReader(body)}
+	for {
+		c, err := b.r.Peek(1)
+		if err == io.EOF {
+			b.done = true
+			return b, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch c[0] {
+		case ' ', '\t', '\r', '\n':
+			b.r.ReadByte()
+			continue
+		case '[':
+			b.array = json.NewDecoder(b.r)
+			if _, err := b.array.Token(); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+}
+
+// Next returns the next row or why it can't be decoded, io.EOF after the
+// last one.
+func (b *RowReader) Next() (map[string]interface{}, error) {
+	if b.done {
+		return nil, io.EOF
+	}
+
+	var row map[string]interface{}
+	if b.array != nil {
+		if !b.array.More() {
+			b.done = true
+			if _, err := b.array.Token(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		if err := b.array.Decode(&row); err != nil {
+			b.done = true
+			return nil, err
+		}
+	} else {
+		var line []byte
+		for len(line) == 0 {
+			var err error
+			line, err = b.r.ReadBytes('\n')
+			if err == io.EOF {
+				b.done = true
+				if line = bytes.TrimSpace(line); len(line) == 0 {
+					return nil, io.EOF
+				}
+			} else if err != nil {
+				b.done = true
+				return nil, err
+			}
+			line = bytes.TrimSpace(line)
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, err
+		}
+	}
+
+	if row == nil {
+		return nil, errors.New("a row must be an object")
+	}
+	return row, nil
+}
@@ -0,0 +1,462 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+var ErrBadInput = errors.New("input can't be imported")
+
+var TransferFormatsEnum = [3]string{
+	"csv",
+	"json",
+	"ndjson",
+}
+
+// formats of export and import, indexes of TransferFormatsEnum
+const (
+	CSVFormat uint8 = iota
+	JSONFormat
+	NDJSONFormat
+)
+
+// CSV_NULL is the field of a missing value in a string column of a CSV, an
+// empty field there is an empty string.
+const CSV_NULL = `\N`
+
+// TransferFormatByName finds a format, csv when the name is empty.
+func TransferFormatByName(name string) (uint8, error) {
+	if name == "" {
+		return CSVFormat, nil
+	}
+	for idx, format := range TransferFormatsEnum {
+		if format == name {
+			return uint8(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q, use one of %s", name, strings.Join(TransferFormatsEnum[:], ", "))
+}
+
+// ParseDelimiter reads the delimiter of CSV fields, a comma when empty.
+// A tab is given as tab or \t.
+func ParseDelimiter(s string) (rune, error) {
+	switch s {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("delimiter %q is not allowed", s)
+	}
+	return r, nil
+}
+
+// TransferOptions tells how rows are exported or imported.
+type TransferOptions struct {
+	Format    uint8
+	Delimiter rune // of CSV fields
+	DryRun    bool // import only: check the rows without inserting them
+	Batch     int  // import only: rows inserted at once, BULK_BATCH_SIZE when 0
+}
+
+// ExportTable writes the rows of the table with their ids, in the order of
+// the table. A CSV starts with a header of the column names, a missing
+// value is an empty field, CSV_NULL in a string column. It returns how many
+// rows were written.
+func ExportTable(db *common.DB, tid common.TableIdType, w io.Writer, opts TransferOptions) (int, error) {
+	export, err := ReadExport(db, tid)
+	if err != nil {
+		return 0, err
+	}
+	return export.Write(w, opts)
+}
+
+// Export holds the rows of a table as they were when it was read, so a
+// table that can't be read fails before anything is written.
+type Export struct {
+	columns []common.TableColumn
+	rows    []common.Row[common.ColumnIdType]
+}
+
+// ReadExport copies the rows of the table to be written by Export.Write.
+func ReadExport(db *common.DB, tid common.TableIdType) (*Export, error) {
+	export := &Export{}
+	err := db.ReadTable(tid, func(table *common.Table, meta *common.TableMetaData) error {
+		export.columns = append(export.columns, meta.Columns...)
+		for _, row := range table.Rows {
+			if row.Deleted {
+				continue
+			}
+			// the values are copied, updates change the map of a row
+			cols := make(map[common.ColumnIdType]interface{}, len(row.Columns))
+			for id, val := range row.Columns {
+				cols[id] = val
+			}
+			export.rows = append(export.rows, common.Row[common.ColumnIdType]{Id: row.Id, Columns: cols})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Write writes the rows as ExportTable does and returns how many were
+// written.
+func (e *Export) Write(w io.Writer, opts TransferOptions) (int, error) {
+	columns, rows := e.columns, e.rows
+	if opts.Format == CSVFormat {
+		return len(rows), exportCSV(w, opts.Delimiter, columns, rows)
+	}
+
+	bw := bufio.NewWriter(w)
+	if opts.Format == JSONFormat {
+		bw.WriteString("[")
+	}
+	for i, row := range rows {
+		doc := make(map[string]interface{}, len(columns)+1)
+		doc["id"] = row.Id
+		for _, col := range columns {
+			if val, ok := row.Columns[col.Id]; ok {
+				doc[col.Name] = val
+			}
+		}
+		content, err := json.Marshal(doc)
+		if err != nil {
+			return i, err
+		}
+
+		if opts.Format == JSONFormat {
+			if i > 0 {
+				bw.WriteString(",")
+			}
+			bw.WriteString("\n")
+		}
+		bw.Write(content)
+		if opts.Format == NDJSONFormat {
+			bw.WriteString("\n")
+		}
+	}
+	if opts.Format == JSONFormat {
+		if len(rows) > 0 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("]\n")
+	}
+	return len(rows), bw.Flush()
+}
+
+func exportCSV(w io.Writer, delimiter rune, columns []common.TableColumn, rows []common.Row[common.ColumnIdType]) error {
+	cw := csv.NewWriter(w)
+	if delimiter != 0 {
+		cw.Comma = delimiter
+	}
+
+	record := make([]string, len(columns)+1)
+	record[0] = "id"
+	for i, col := range columns {
+		record[i+1] = col.Name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record[0] = strconv.FormatUint(uint64(row.Id), 10)
+		for i, col := range columns {
+			val := row.Columns[col.Id]
+			if val == nil && col.Type == common.StringColumn {
+				record[i+1] = CSV_NULL
+			} else {
+				record[i+1] = formatField(val)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatField(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(val)
+}
+
+// ImportError tells why a row of an import wasn't inserted. Rows are
+// counted from 1 in the order of the input, the header of a CSV is not a row.
+type ImportError struct {
+	Row    int                 `json:"row"`
+	Error  string              `json:"error"`
+	Fields []common.FieldError `json:"fields,omitempty"`
+}
+
+// ImportResult counts the rows read and inserted. With DryRun nothing is
+// inserted and Errors lists the rows that would fail validation.
+type ImportResult struct {
+	Ok       bool          `json:"ok"`
+	Read     int           `json:"read"`
+	Inserted int           `json:"inserted"`
+	Failed   int           `json:"failed"`
+	DryRun   bool          `json:"dry_run,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Errors   []ImportError `json:"errors"`
+}
+
+func (r *ImportResult) fail(row int, err error) {
+	var verr *common.ValidationError
+	if errors.As(err, &verr) {
+		r.Errors = append(r.Errors, ImportError{Row: row, Error: common.ResponseStrings["V1"], Fields: verr.Fields})
+	} else {
+		r.Errors = append(r.Errors, ImportError{Row: row, Error: err.Error()})
+	}
+	r.Failed++
+}
+
+// ImportTable inserts the rows read from r into the table in batches, a row
+// that can't be inserted is reported and skipped. Values are converted to
+// the types of their columns where they can be, so "42" fits a number column
+// and 42 a string one. The id of exported rows is ignored, rows get new ids.
+//
+// A dry run only validates the rows, a row that would break a unique
+// column is not found by it.
+func ImportTable(db *common.DB, tid common.TableIdType, r io.Reader, opts TransferOptions) (ImportResult, error) {
+	var columns []common.TableColumn
+	err := db.ReadTable(tid, func(_ *common.Table, meta *common.TableMetaData) error {
+		columns = append(columns, meta.Columns...)
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	var source interface {
+		Next() (map[string]interface{}, error)
+	}
+	switch opts.Format {
+	case CSVFormat:
+		source, err = newCSVRows(r, opts.Delimiter, columns)
+	case JSONFormat, NDJSONFormat:
+		var reader *RowReader
+		if reader, err = NewRowReader(r); err == nil {
+			if !reader.done && opts.Format == JSONFormat && reader.array == nil {
+				err = errors.New("expected a JSON array")
+			} else if !reader.done && opts.Format == NDJSONFormat && reader.array != nil {
+				err = errors.New("expected an object per line")
+			}
+		}
+		source = reader
+	default:
+		err = fmt.Errorf("unknown format %d", opts.Format)
+	}
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("%w: %s", ErrBadInput, err)
+	}
+
+	size := opts.Batch
+	if size <= 0 {
+		size = BULK_BATCH_SIZE
+	}
+	result := ImportResult{DryRun: opts.DryRun, Errors: []ImportError{}}
+	var batch []map[common.ColumnIdType]interface{}
+	var positions []int
+	flush := func() error {
+		defer func() {
+			batch, positions = batch[:0], positions[:0]
+		}()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		_, errs, err := db.InsertRows(tid, batch, false)
+		if err != nil {
+			return err
+		}
+		for i, err := range errs {
+			if err != nil {
+				result.fail(positions[i], err)
+			} else {
+				result.Inserted++
+			}
+		}
+		return nil
+	}
+
+	for {
+		values, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		result.Read++
+
+		var cols map[common.ColumnIdType]interface{}
+		if err == nil {
+			coerceRow(values, columns)
+			cols, err = db.PrepareColumns(tid, values, false)
+		}
+		if err != nil {
+			result.fail(result.Read, err)
+			continue
+		}
+		if opts.DryRun {
+			continue
+		}
+
+		batch = append(batch, cols)
+		positions = append(positions, result.Read)
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+
+	result.Ok = result.Failed == 0
+	return result, nil
+}
+
+// coerceRow drops the id of the row and converts its values to the types of
+// their columns. A value that can't be converted is kept for validation to
+// report it.
+func coerceRow(values map[string]interface{}, columns []common.TableColumn) {
+	delete(values, "id")
+	for _, col := range columns {
+		if val, ok := values[col.Name]; ok {
+			values[col.Name] = coerceValue(val, col.Type)
+		}
+	}
+}
+
+func coerceValue(val interface{}, typ uint8) interface{} {
+	switch v := val.(type) {
+	case string:
+		switch typ {
+		case common.NumberColumn:
+			if num, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return num
+			}
+		case common.BoolColumn:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		}
+	case float64, bool:
+		if typ == common.StringColumn {
+			return formatField(v)
+		}
+	}
+	return val
+}
+
+// csvRows reads the rows of a CSV whose header names the columns. An empty
+// field is a missing value, but an empty string in a string column, where
+// CSV_NULL is a missing value.
+type csvRows struct {
+	r       *csv.Reader
+	columns []*common.TableColumn // of the fields, nil for the id
+	done    bool
+}
+
+func newCSVRows(r io.Reader, delimiter rune, columns []common.TableColumn) (*csvRows, error) {
+	cr := csv.NewReader(r)
+	if delimiter != 0 {
+		cr.Comma = delimiter
+	}
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the header is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &csvRows{r: cr, columns: make([]*common.TableColumn, len(header))}
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			return nil, fmt.Errorf("column %q is repeated in the header", name)
+		}
+		seen[name] = true
+		if name == "id" {
+			continue
+		}
+		idx := -1
+		for j := range columns {
+			if columns[j].Name == name {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown column %q in the header", name)
+		}
+		rows.columns[i] = &columns[idx]
+	}
+	return rows, nil
+}
+
+// Next returns the next row or why it can't be read, io.EOF after the last
+// one. A malformed line fails alone, other errors end the input.
+func (c *csvRows) Next() (map[string]interface{}, error) {
+	if c.done {
+		return nil, io.EOF
+	}
+
+	record, err := c.r.Read()
+	if err == io.EOF {
+		c.done = true
+		return nil, io.EOF
+	}
+	if err != nil {
+		var perr *csv.ParseError
+		if !errors.As(err, &perr) {
+			c.done = true
+		}
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(record))
+	for i, field := range record {
+		col := c.columns[i]
+		if col == nil {
+			continue
+		}
+		missing := field == ""
+		if col.Type == common.StringColumn {
+			missing = field == CSV_NULL
+		}
+		if missing {
+			continue
+		}
+		row[col.Name] = field
+	}
+	return row, nil
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+func TestExportTable(t *testing.T) {
+	tests := []struct {
+		opts     TransferOptions
+		expected string
+	}{
+		{TransferOptions{Format: CSVFormat, Delimiter: ';'}, "id;name;age\n0;alice;30\n1;bob;25\n2;carol;\n3;dave;41\n"},
+		{TransferOptions{Format: NDJSONFormat}, `{"age":30,"id":0,"name":"alice"}` + "\n" +
+			`{"age":25,"id":1,"name":"bob"}` + "\n" +
+			`{"id":2,"name":"carol"}` + "\n" +
+			`{"age":41,"id":3,"name":"dave"}` + "\n"},
+	}
+
+	for _, test := range tests {
+		configQuery(t)
+		var out bytes.Buffer
+		n, err := ExportTable(common.Default, 1, &out, test.opts)
+		if err != nil || n != 4 || out.String() != test.expected {
+			t.Fatalf("expected: %q, but returned %d %q %v", test.expected, n, out.String(), err)
+		}
+	}
+
+	configQuery(t)
+	var out bytes.Buffer
+	if _, err := ExportTable(common.Default, 1, &out, TransferOptions{Format: JSONFormat}); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &rows); err != nil || len(rows) != 4 {
+		t.Fatalf("expected 4 rows, but returned %q %v", out.String(), err)
+	}
+}
+
+func TestImportTable(t *testing.T) {
+	tests := []struct {
+		opts     TransferOptions
+		input    string
+		inserted int
+		rows     []int // of the errors
+	}{
+		{TransferOptions{Format: CSVFormat, Delimiter: ';'}, "id;name;age\n0;eve; 20\n1;fay;\n2;;x\n3;\"g;us\";1e1\n", 3, []int{3}},
+		{TransferOptions{Format: CSVFormat, Delimiter: ','}, "age,name\n1,eve\n2\n3,fay\n", 2, []int{2}},
+		{TransferOptions{Format: JSONFormat}, `[{"id": 7, "name": "eve", "age": "20"}, {"name": true}, {"age": 1}]`, 2, []int{3}},
+		{TransferOptions{Format: NDJSONFormat}, "{\"name\": 1}\n{broken\n{\"name\": \"fay\", \"other\": 1}\n", 1, []int{2, 3}},
+		{TransferOptions{Format: CSVFormat, DryRun: true}, "name,age\neve,20\nfay,old\n", 0, []int{2}},
+	}
+
+	for _, test := range tests {
+		configQuery(t)
+		result, err := ImportTable(common.Default, 1, strings.NewReader(test.input), test.opts)
+		if err != nil {
+			t.Fatalf("%q: %v", test.input, err)
+		}
+		rows := []int{}
+		for _, e := range result.Errors {
+			rows = append(rows, e.Row)
+		}
+		if result.Inserted != test.inserted || !reflect.DeepEqual(rows, test.rows) || result.Ok != (len(rows) == 0) {
+			t.Fatalf("%q: unexpected result %+v", test.input, result)
+		}
+
+		var count int
+		common.Default.ReadTable(1, func(table *common.Table, _ *common.TableMetaData) error {
+			count = len(table.Rows)
+			return nil
+		})
+		if count != 4+test.inserted {
+			t.Fatalf("%q: expected: %d rows, but returned %d", test.input, 4+test.inserted, count)
+		}
+	}
+}
+
+func TestImportCoercion(t *testing.T) {
+	configQuery(t)
+	runSQL(t, "CREATE TABLE flags (label STRING, on BOOL, weight NUMBER NULL)")
+	input := "label,on,weight\n,true,\n12,FALSE, 0.5 \n"
+	result, err := ImportTable(common.Default, 2, strings.NewReader(input), TransferOptions{Delimiter: ','})
+	if err != nil || !result.Ok || result.Inserted != 2 {
+		t.Fatalf("unexpected result %+v %v", result, err)
+	}
+
+	var out bytes.Buffer
+	if _, err := ExportTable(common.Default, 2, &out, TransferOptions{Format: NDJSONFormat}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":0,"label":"","on":true}` + "\n" + `{"id":1,"label":"12","on":false,"weight":0.5}` + "\n"
+	if out.String() != expected {
+		t.Fatalf("expected: %q, but returned %q", expected, out.String())
+	}
+}
+
+func TestCSVNullStrings(t *testing.T) {
+	configQuery(t)
+	runSQL(t, "CREATE TABLE notes (title STRING, body STRING NULL)")
+	runSQL(t, "INSERT INTO notes (title, body) VALUES ('a', ''), ('b', NULL)")
+
+	var out bytes.Buffer
+	if _, err := ExportTable(common.Default, 2, &out, TransferOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id,title,body\n0,a,\n1,b,\\N\n"
+	if out.String() != expected {
+		t.Fatalf("expected: %q, but returned %q", expected, out.String())
+	}
+
+	result, err := ImportTable(common.Default, 2, strings.NewReader(out.String()), TransferOptions{})
+	if err != nil || !result.Ok || result.Inserted != 2 {
+		t.Fatalf("unexpected result %+v %v", result, err)
+	}
+	out.Reset()
+	if _, err := ExportTable(common.Default, 2, &out, TransferOptions{Format: NDJSONFormat}); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"body":"","id":0,"title":"a"}` + "\n" + `{"id":1,"title":"b"}` + "\n" +
+		`{"body":"","id":2,"title":"a"}` + "\n" + `{"id":3,"title":"b"}` + "\n"
+	if out.String() != expected {
+		t.Fatalf("expected: %q, but returned %q", expected, out.String())
+	}
+}
+
+func TestImportBadInput(t *testing.T) {
+	for _, test := range []struct {
+		format uint8
+		input  string
+	}{
+		{CSVFormat, "name,height\neve,1\n"},
+		{CSVFormat, "name,name\neve,eve\n"},
+		{CSVFormat, ""},
+		{JSONFormat, "{\"name\": \"eve\"}\n"},
+		{NDJSONFormat, `[{"name": "eve"}]`},
+	} {
+		configQuery(t)
+		_, err := ImportTable(common.Default, 1, strings.NewReader(test.input), TransferOptions{Format: test.format, Delimiter: ','})
+		if !errors.Is(err, ErrBadInput) {
+			t.Fatalf("%q: expected: %v, but returned %v", test.input, ErrBadInput, err)
+		}
+	}
+}
@@ -55,6 +55,16 @@ func (ctx *RequestContext) Error(statusMessage string, statusCode int) {
 	http.Error(ctx.Response, statusMessage, statusCode)
 }
 
+func (ctx *RequestContext) ErrorJSON(response any, statusCode int) {
+	out, err := json.Marshal(response)
+	if err != nil {
+		panic("Unable to Marshal this object")
+	}
+	ctx.Response.Header().Set("Content-Type", "application/json")
+	ctx.Response.WriteHeader(statusCode)
+	ctx.SendBytes(out)
+}
+
 func (ctx *RequestContext) Read(dest any) error {
 	err := json.NewDecoder(ctx.Request.Body).Decode(dest)
 	if err != nil {
@@ -0,0 +1,136 @@
+// Package query parses the SQL subset curiodb understands:
+//
+//	CREATE TABLE users (name STRING, age NUMBER NULL)
+//	ALTER TABLE users ADD COLUMN admin BOOL
+//	INSERT INTO users (name, age) VALUES ('alice', 30), (?, ?)
+//	SELECT id, name FROM users WHERE age > 18 AND name LIKE 'a%'
+//	    ORDER BY age DESC, name LIMIT 10 OFFSET 20
+//	UPDATE users SET age = $1 WHERE id = $2
+//	DELETE FROM users WHERE name = 'bob'
+package query
+
+import "fmt"
+
+type Statement interface {
+	statement()
+}
+
+type ColumnDef struct {
+	Name     string
+	Type     uint8 // index of common.ColumnsTypeEnum
+	Optional bool
+	Unique   bool
+	Primary  bool
+}
+
+type CreateTable struct {
+	Name    string
+	Columns []ColumnDef
+}
+
+type AddColumn struct {
+	Table  string
+	Column ColumnDef
+}
+
+type Insert struct {
+	Table   string
+	Columns []string
+	Rows    [][]Expr
+}
+
+type Select struct {
+	Table   string
+	Columns []ColumnRef // nil selects the id and every column
+	Where   []Condition
+	OrderBy []Order
+	Limit   Expr // nil when there is no limit
+	Offset  Expr
+}
+
+type Update struct {
+	Table string
+	Set   []Assignment
+	Where []Condition
+}
+
+type Delete struct {
+	Table string
+	Where []Condition
+}
+
+func (*CreateTable) statement() {}
+func (*AddColumn) statement()   {}
+func (*Insert) statement()      {}
+func (*Select) statement()      {}
+func (*Update) statement()      {}
+func (*Delete) statement()      {}
+
+// Pos is where a part of a statement starts in the query text.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+type ColumnRef struct {
+	Name string
+	Pos  Pos
+}
+
+type Assignment struct {
+	Column string
+	Value  Expr
+	Pos    Pos
+}
+
+// Condition compares a column with a value, conditions of a WHERE clause
+// must all hold.
+type Condition struct {
+	Column string
+	Op     string // =, !=, <, >, <=, >= or LIKE
+	Value  Expr
+	Pos    Pos
+}
+
+type Order struct {
+	Column string
+	Desc   bool
+	Pos    Pos
+}
+
+type Expr interface {
+	expr()
+}
+
+// Literal is a float64, string, bool or nil.
+type Literal struct {
+	Value any
+}
+
+// Placeholder is the zero-based index of an argument bound at execution.
+type Placeholder struct {
+	Index int
+}
+
+func (Literal) expr()     {}
+func (Placeholder) expr() {}
+
+// Query is a parsed statement with the number of arguments it takes.
+type Query struct {
+	Statement Statement
+	Params    int
+}
+
+// Bind resolves the expression with the arguments of the execution.
+func Bind(e Expr, args []any) (any, error) {
+	switch e := e.(type) {
+	case Literal:
+		return e.Value, nil
+	case Placeholder:
+		if e.Index >= len(args) {
+			return nil, fmt.Errorf("missing argument %d", e.Index+1)
+		}
+		return args[e.Index], nil
+	}
+	return nil, nil
+}
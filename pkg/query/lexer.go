@@ -0,0 +1,196 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type TokenKind uint8
+
+const (
+	EOF TokenKind = iota
+	Ident
+	Keyword
+	Number
+	String
+	Param
+	Symbol
+)
+
+type Token struct {
+	Kind   TokenKind
+	Text   string // keywords are upper case, quotes are removed from strings
+	Line   int
+	Column int
+}
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true,
+	"INSERT": true, "INTO": true, "VALUES": true, "UPDATE": true, "SET": true,
+	"DELETE": true, "CREATE": true, "TABLE": true, "ALTER": true, "ADD": true,
+	"COLUMN": true, "NULL": true, "TRUE": true, "FALSE": true, "LIKE": true,
+	"ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true,
+	"UNIQUE": true, "PRIMARY": true, "KEY": true,
+}
+
+// ParseError points at the place in the query the error was found.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func errorAt(tok Token, format string, args ...any) error {
+	return errorAtPos(tok.pos(), format, args...)
+}
+
+func errorAtPos(pos Pos, format string, args ...any) error {
+	return &ParseError{pos.Line, pos.Column, fmt.Sprintf(format, args...)}
+}
+
+func (t Token) pos() Pos {
+	return Pos{t.Line, t.Column}
+}
+
+type lexer struct {
+	src    []rune
+	pos    int
+	line   int
+	column int
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset < len(l.src) {
+		return l.src[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *lexer) advance() rune {
+	r := l.src[l.pos]
+	l.pos++
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return r
+}
+
+func tokenize(src string) ([]Token, error) {
+	l := &lexer{src: []rune(src), line: 1, column: 1}
+	var tokens []Token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == EOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (Token, error) {
+	for l.pos < len(l.src) {
+		if unicode.IsSpace(l.peek(0)) {
+			l.advance()
+		} else if l.peek(0) == '-' && l.peek(1) == '-' {
+			for l.pos < len(l.src) && l.peek(0) != '\n' {
+				l.advance()
+			}
+		} else {
+			break
+		}
+	}
+
+	tok := Token{Line: l.line, Column: l.column}
+	if l.pos >= len(l.src) {
+		return tok, nil
+	}
+
+	r := l.peek(0)
+	switch {
+	case unicode.IsLetter(r) || r == '_':
+		var sb strings.Builder
+		for l.pos < len(l.src) && (unicode.IsLetter(l.peek(0)) || unicode.IsDigit(l.peek(0)) || l.peek(0) == '_') {
+			sb.WriteRune(l.advance())
+		}
+		tok.Kind, tok.Text = Ident, sb.String()
+		if upper := strings.ToUpper(tok.Text); keywords[upper] {
+			tok.Kind, tok.Text = Keyword, upper
+		}
+
+	case unicode.IsDigit(r) || (r == '.' && unicode.IsDigit(l.peek(1))) ||
+		(r == '-' && (unicode.IsDigit(l.peek(1)) || l.peek(1) == '.')):
+		var sb strings.Builder
+		sb.WriteRune(l.advance())
+		for l.pos < len(l.src) && (unicode.IsDigit(l.peek(0)) || l.peek(0) == '.' ||
+			l.peek(0) == 'e' || l.peek(0) == 'E' ||
+			((l.peek(0) == '-' || l.peek(0) == '+') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E'))) {
+			sb.WriteRune(l.advance())
+		}
+		tok.Kind, tok.Text = Number, sb.String()
+
+	case r == '\'' || r == '"':
+		// 'string' or "identifier", a doubled quote stands for itself
+		quote := l.advance()
+		var sb strings.Builder
+		for {
+			if l.pos >= len(l.src) {
+				return tok, errorAt(tok, "unterminated %c", quote)
+			}
+			c := l.advance()
+			if c == quote {
+				if l.peek(0) != quote {
+					break
+				}
+				l.advance()
+			}
+			sb.WriteRune(c)
+		}
+		tok.Kind, tok.Text = String, sb.String()
+		if quote == '"' {
+			tok.Kind = Ident
+		}
+
+	case r == '?':
+		l.advance()
+		tok.Kind, tok.Text = Param, "?"
+
+	case r == '$' && unicode.IsDigit(l.peek(1)):
+		var sb strings.Builder
+		sb.WriteRune(l.advance())
+		for l.pos < len(l.src) && unicode.IsDigit(l.peek(0)) {
+			sb.WriteRune(l.advance())
+		}
+		tok.Kind, tok.Text = Param, sb.String()
+
+	default:
+		end := l.pos + 2
+		if end > len(l.src) {
+			end = len(l.src)
+		}
+		for _, sym := range []string{"!=", "<>", "<=", ">=", "(", ")", ",", "*", "=", "<", ">", ";"} {
+			if strings.HasPrefix(string(l.src[l.pos:end]), sym) {
+				for range sym {
+					l.advance()
+				}
+				tok.Kind, tok.Text = Symbol, sym
+				if sym == "<>" {
+					tok.Text = "!="
+				}
+				return tok, nil
+			}
+		}
+		return tok, errorAt(tok, "unexpected character %q", r)
+	}
+	return tok, nil
+}
@@ -0,0 +1,501 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// column types by their SQL names
+var columnTypes = map[string]uint8{
+	"NUMBER": common.NumberColumn, "INT": common.NumberColumn, "INTEGER": common.NumberColumn,
+	"REAL": common.NumberColumn, "FLOAT": common.NumberColumn, "DOUBLE": common.NumberColumn,
+	"STRING": common.StringColumn, "TEXT": common.StringColumn, "VARCHAR": common.StringColumn,
+	"BOOL": common.BoolColumn, "BOOLEAN": common.BoolColumn,
+}
+
+var comparisons = map[string]bool{"=": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true}
+
+type parser struct {
+	tokens []Token
+	pos    int
+	params int
+	next   int // index of the next `?` placeholder
+}
+
+// Parse parses a single statement, a trailing semicolon is allowed.
+func Parse(src string) (*Query, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if tok := p.peek(); tok.Kind != EOF {
+		return nil, p.unexpected(tok)
+	}
+	return &Query{Statement: stmt, Params: p.params}, nil
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) take() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != EOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok Token, format string, args ...any) error {
+	return errorAt(tok, format, args...)
+}
+
+func (p *parser) unexpected(tok Token) error {
+	if tok.Kind == EOF {
+		return p.errorf(tok, "unexpected end of query")
+	}
+	return p.errorf(tok, "unexpected %q", tok.Text)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if tok := p.peek(); tok.Kind == Keyword && tok.Text == kw {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptSymbol(sym string) bool {
+	if tok := p.peek(); tok.Kind == Symbol && tok.Text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		tok := p.peek()
+		if tok.Kind == EOF {
+			return p.errorf(tok, "expected %s", kw)
+		}
+		return p.errorf(tok, "expected %s, got %q", kw, tok.Text)
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		tok := p.peek()
+		if tok.Kind == EOF {
+			return p.errorf(tok, "expected %q", sym)
+		}
+		return p.errorf(tok, "expected %q, got %q", sym, tok.Text)
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	tok := p.peek()
+	if tok.Kind != Ident {
+		if tok.Kind == EOF {
+			return "", p.errorf(tok, "expected a name")
+		}
+		return "", p.errorf(tok, "expected a name, got %q", tok.Text)
+	}
+	p.pos++
+	return tok.Text, nil
+}
+
+func (p *parser) statement() (Statement, error) {
+	tok := p.take()
+	if tok.Kind == Keyword {
+		switch tok.Text {
+		case "SELECT":
+			return p.selectStmt()
+		case "INSERT":
+			return p.insertStmt()
+		case "UPDATE":
+			return p.updateStmt()
+		case "DELETE":
+			return p.deleteStmt()
+		case "CREATE":
+			return p.createStmt()
+		case "ALTER":
+			return p.alterStmt()
+		}
+	}
+	return nil, p.unexpected(tok)
+}
+
+func (p *parser) selectStmt() (Statement, error) {
+	stmt := &Select{}
+	if !p.acceptSymbol("*") {
+		for {
+			pos := p.peek().pos()
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, ColumnRef{name, pos})
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if stmt.Where, err = p.where(); err != nil {
+		return nil, err
+	}
+	if stmt.OrderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.count(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.count(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// orderBy parses `ORDER BY column [ASC | DESC], ...`.
+func (p *parser) orderBy() ([]Order, error) {
+	if !p.acceptKeyword("ORDER") {
+		return nil, nil
+	}
+	if err := p.expectKeyword("BY"); err != nil {
+		return nil, err
+	}
+	var order []Order
+	for {
+		pos := p.peek().pos()
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		desc := p.acceptKeyword("DESC")
+		if !desc {
+			p.acceptKeyword("ASC")
+		}
+		order = append(order, Order{name, desc, pos})
+		if !p.acceptSymbol(",") {
+			return order, nil
+		}
+	}
+}
+
+// count parses the value of LIMIT or OFFSET, a non-negative integer or a
+// placeholder checked when it is bound.
+func (p *parser) count() (Expr, error) {
+	tok := p.peek()
+	val, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if lit, ok := val.(Literal); ok {
+		num, ok := lit.Value.(float64)
+		if !ok || num < 0 || num != float64(int(num)) {
+			return nil, p.errorf(tok, "expected a non-negative integer, got %q", tok.Text)
+		}
+	}
+	return val, nil
+}
+
+func (p *parser) insertStmt() (Statement, error) {
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	stmt := &Insert{}
+	var err error
+	if stmt.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, name)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		start := p.peek()
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var row []Expr
+		for {
+			val, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, val)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if len(row) != len(stmt.Columns) {
+			return nil, p.errorf(start, "%d values for %d columns", len(row), len(stmt.Columns))
+		}
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) updateStmt() (Statement, error) {
+	stmt := &Update{}
+	var err error
+	if stmt.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		pos := p.peek().pos()
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, Assignment{name, val, pos})
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	stmt.Where, err = p.where()
+	return stmt, err
+}
+
+func (p *parser) deleteStmt() (Statement, error) {
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	stmt := &Delete{}
+	var err error
+	if stmt.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	stmt.Where, err = p.where()
+	return stmt, err
+}
+
+func (p *parser) createStmt() (Statement, error) {
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateTable{}
+	var err error
+	if stmt.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol("(") {
+		return stmt, nil
+	}
+	// the columns are checked together so a table is not left half-built by
+	// a column that can't be added
+	seen := make(map[string]bool)
+	primary := false
+	for {
+		tok := p.peek()
+		col, err := p.columnDef()
+		if err != nil {
+			return nil, err
+		}
+		if seen[col.Name] {
+			return nil, p.errorf(tok, "column %q is repeated", col.Name)
+		}
+		if col.Primary && primary {
+			return nil, p.errorf(tok, "a table has only one primary key")
+		}
+		seen[col.Name], primary = true, primary || col.Primary
+		stmt.Columns = append(stmt.Columns, col)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return stmt, p.expectSymbol(")")
+}
+
+func (p *parser) alterStmt() (Statement, error) {
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &AddColumn{}
+	var err error
+	if stmt.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("ADD"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("COLUMN")
+	stmt.Column, err = p.columnDef()
+	return stmt, err
+}
+
+// columnDef parses `name TYPE [NULL | NOT NULL]`, columns are required
+// unless NULL is given.
+func (p *parser) columnDef() (ColumnDef, error) {
+	var col ColumnDef
+	var err error
+	start := p.peek()
+	if col.Name, err = p.ident(); err != nil {
+		return col, err
+	}
+
+	tok := p.take()
+	typ, ok := columnTypes[strings.ToUpper(tok.Text)]
+	if tok.Kind != Ident || !ok {
+		if tok.Kind == EOF {
+			return col, p.errorf(tok, "expected a column type")
+		}
+		return col, p.errorf(tok, "unknown column type %q", tok.Text)
+	}
+	col.Type = typ
+
+	for {
+		switch {
+		case p.acceptKeyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return col, err
+			}
+		case p.acceptKeyword("NULL"):
+			col.Optional = true
+		case p.acceptKeyword("UNIQUE"):
+			col.Unique = true
+		case p.acceptKeyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return col, err
+			}
+			col.Primary = true
+		default:
+			if col.Primary && col.Optional {
+				return col, p.errorf(start, "primary key %q can't be null", col.Name)
+			}
+			return col, nil
+		}
+	}
+}
+
+func (p *parser) where() ([]Condition, error) {
+	if !p.acceptKeyword("WHERE") {
+		return nil, nil
+	}
+	var conds []Condition
+	for {
+		pos := p.peek().pos()
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+
+		tok := p.take()
+		var op string
+		switch {
+		case tok.Kind == Symbol && comparisons[tok.Text]:
+			op = tok.Text
+		case tok.Kind == Keyword && tok.Text == "LIKE":
+			op = "LIKE"
+		default:
+			return nil, p.unexpected(tok)
+		}
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, Condition{name, op, val, pos})
+
+		if tok := p.peek(); tok.Kind == Keyword && tok.Text == "OR" {
+			return nil, p.errorf(tok, "OR is not supported")
+		}
+		if !p.acceptKeyword("AND") {
+			return conds, nil
+		}
+	}
+}
+
+func (p *parser) value() (Expr, error) {
+	tok := p.take()
+	switch tok.Kind {
+	case Number:
+		num, err := strconv.ParseFloat(tok.Text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "bad number %q", tok.Text)
+		}
+		return Literal{num}, nil
+	case String:
+		return Literal{tok.Text}, nil
+	case Keyword:
+		switch tok.Text {
+		case "TRUE":
+			return Literal{true}, nil
+		case "FALSE":
+			return Literal{false}, nil
+		case "NULL":
+			return Literal{nil}, nil
+		}
+	case Param:
+		idx := p.next
+		if tok.Text == "?" {
+			p.next++
+		} else {
+			n, err := strconv.Atoi(tok.Text[1:])
+			if err != nil || n < 1 {
+				return nil, p.errorf(tok, "bad placeholder %s", tok.Text)
+			}
+			idx = n - 1
+		}
+		if idx+1 > p.params {
+			p.params = idx + 1
+		}
+		return Placeholder{idx}, nil
+	}
+	return nil, p.unexpected(tok)
+}
@@ -0,0 +1,140 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSelect(t *testing.T) {
+	q, err := Parse("select id, \"name\" from users where age > 18 and name like 'a%' and admin = ?;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Select{
+		Table:   "users",
+		Columns: []ColumnRef{{"id", Pos{1, 8}}, {"name", Pos{1, 12}}},
+		Where: []Condition{
+			{"age", ">", Literal{18.0}, Pos{1, 36}},
+			{"name", "LIKE", Literal{"a%"}, Pos{1, 49}},
+			{"admin", "=", Placeholder{0}, Pos{1, 68}},
+		},
+	}
+	if !reflect.DeepEqual(q.Statement, expected) || q.Params != 1 {
+		t.Fatalf("expected: %+v, but returned %+v", expected, q.Statement)
+	}
+}
+
+func TestParseOrderLimit(t *testing.T) {
+	q, err := Parse("SELECT * FROM users ORDER BY age DESC, name ASC LIMIT 10 OFFSET ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Select{
+		Table:   "users",
+		OrderBy: []Order{{"age", true, Pos{1, 30}}, {"name", false, Pos{1, 40}}},
+		Limit:   Literal{10.0},
+		Offset:  Placeholder{0},
+	}
+	if !reflect.DeepEqual(q.Statement, expected) || q.Params != 1 {
+		t.Fatalf("expected: %+v, but returned %+v", expected, q.Statement)
+	}
+
+	if _, err := Parse("SELECT * FROM users LIMIT -1"); err == nil {
+		t.Fatal("expected a negative limit to fail")
+	}
+}
+
+func TestParseInsert(t *testing.T) {
+	q, err := Parse("INSERT INTO users (name, age) VALUES ('it''s', -1.5), ($2, $1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Insert{
+		Table:   "users",
+		Columns: []string{"name", "age"},
+		Rows: [][]Expr{
+			{Literal{"it's"}, Literal{-1.5}},
+			{Placeholder{1}, Placeholder{0}},
+		},
+	}
+	if !reflect.DeepEqual(q.Statement, expected) || q.Params != 2 {
+		t.Fatalf("expected: %+v, but returned %+v", expected, q.Statement)
+	}
+}
+
+func TestParseCreateTable(t *testing.T) {
+	q, err := Parse("CREATE TABLE users (name TEXT NOT NULL, age INTEGER NULL, admin BOOLEAN)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &CreateTable{
+		Name: "users",
+		Columns: []ColumnDef{
+			{Name: "name", Type: 1},
+			{Name: "age", Type: 0, Optional: true},
+			{Name: "admin", Type: 2},
+		},
+	}
+	if !reflect.DeepEqual(q.Statement, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, q.Statement)
+	}
+}
+
+func TestParseColumnConstraints(t *testing.T) {
+	q, err := Parse("CREATE TABLE users (login TEXT PRIMARY KEY, email TEXT NULL UNIQUE, code INTEGER UNIQUE NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &CreateTable{
+		Name: "users",
+		Columns: []ColumnDef{
+			{Name: "login", Type: 1, Primary: true},
+			{Name: "email", Type: 1, Optional: true, Unique: true},
+			{Name: "code", Type: 0, Unique: true},
+		},
+	}
+	if !reflect.DeepEqual(q.Statement, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, q.Statement)
+	}
+
+	if _, err := Parse("CREATE TABLE users (login TEXT PRIMARY)"); err == nil {
+		t.Fatal("expected PRIMARY without KEY to fail")
+	}
+}
+
+func TestParseBadColumns(t *testing.T) {
+	for _, test := range []struct {
+		src    string
+		column int
+	}{
+		{"CREATE TABLE t (a NUMBER PRIMARY KEY, a STRING)", 39},
+		{"CREATE TABLE t (a NUMBER PRIMARY KEY, b STRING PRIMARY KEY)", 39},
+		{"CREATE TABLE t (a NUMBER NULL PRIMARY KEY)", 17},
+		{"ALTER TABLE t ADD COLUMN a NUMBER PRIMARY KEY NULL", 26},
+	} {
+		_, err := Parse(test.src)
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Column != test.column {
+			t.Fatalf("%s: expected an error at column %d, but returned %v", test.src, test.column, err)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	_, err := Parse("SELECT *\nFROM users\nWHERE age >> 1")
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a parse error, but returned %v", err)
+	}
+	if perr.Line != 3 || perr.Column != 12 {
+		t.Fatalf("expected the error at 3:12, but returned %d:%d (%s)", perr.Line, perr.Column, perr.Msg)
+	}
+
+	if _, err := Parse("INSERT INTO users (a, b) VALUES (1)"); err == nil {
+		t.Fatal("expected a value count mismatch to fail")
+	}
+	if _, err := Parse("DELETE FROM users WHERE a = 1 OR b = 2"); err == nil {
+		t.Fatal("expected OR to be rejected")
+	}
+}
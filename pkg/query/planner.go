@@ -0,0 +1,485 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// Backend runs the operations a statement is planned into, a zero tx means
+// no transaction. Search sorts the rows it finds by the order keys, as the
+// `sort` of `/row/get` does.
+type Backend interface {
+	CreateTable(name string) error
+	DropTable(name string) error
+	AddColumn(tx common.TxIdType, table string, col ColumnDef) error
+	Columns(tx common.TxIdType, table string) ([]common.TableColumn, error)
+	Insert(tx common.TxIdType, table string, values map[string]any) (common.RowIdType, error)
+	Search(tx common.TxIdType, table string, filter common.FilterType, order []common.SortKey) ([]common.Row[string], error)
+	Update(tx common.TxIdType, table string, filter common.FilterType, values map[string]any) (int, error)
+	Delete(tx common.TxIdType, table string, filter common.FilterType) (int, error)
+	Begin() (common.TxIdType, error)
+	Commit(tx common.TxIdType) error
+	Rollback(tx common.TxIdType) error
+}
+
+// Result of a statement. A SELECT fills the columns and rows, the row id is
+// given as a common.RowIdType. Count is the number of rows found, inserted,
+// updated or deleted.
+type Result struct {
+	Columns []common.TableColumn
+	Rows    [][]any
+	LastId  common.RowIdType
+	Count   int
+}
+
+// IdColumn is the row id, it can be selected, filtered and sorted by as if
+// it was a column.
+var IdColumn = common.TableColumn{Id: ^common.ColumnIdType(0), Name: "id", Type: common.NumberColumn}
+
+// Execute runs the query with the arguments of its placeholders.
+func Execute(b Backend, tx common.TxIdType, q *Query, args []any) (*Result, error) {
+	switch st := q.Statement.(type) {
+	case *CreateTable:
+		// tables are created right away even in a transaction, so are their
+		// columns; the table is dropped again if one of them can't be added
+		if err := b.CreateTable(st.Name); err != nil {
+			return nil, err
+		}
+		for _, col := range st.Columns {
+			if err := b.AddColumn(0, st.Name, col); err != nil {
+				b.DropTable(st.Name)
+				return nil, err
+			}
+		}
+		return &Result{}, nil
+
+	case *AddColumn:
+		if err := b.AddColumn(tx, st.Table, st.Column); err != nil {
+			return nil, err
+		}
+		return &Result{}, nil
+
+	case *Insert:
+		return insert(b, tx, st, args)
+
+	case *Select:
+		plan, err := planSelect(b, tx, st, args)
+		if err != nil {
+			return nil, err
+		}
+		return plan.run(b, tx)
+
+	case *Update:
+		set := make(map[string]any, len(st.Set))
+		for _, a := range st.Set {
+			val, err := Bind(a.Value, args)
+			if err != nil {
+				return nil, errorAtPos(a.Pos, "%s", err)
+			}
+			set[a.Column] = val
+		}
+		return change(b, tx, st.Table, st.Where, args, func(tx common.TxIdType, filter common.FilterType) (int, error) {
+			return b.Update(tx, st.Table, filter, set)
+		})
+
+	case *Delete:
+		return change(b, tx, st.Table, st.Where, args, func(tx common.TxIdType, filter common.FilterType) (int, error) {
+			return b.Delete(tx, st.Table, filter)
+		})
+	}
+	return nil, fmt.Errorf("unsupported statement %T", q.Statement)
+}
+
+// within runs fn in the transaction, or in one of its own committed when fn
+// succeeds if there is none.
+func within(b Backend, tx common.TxIdType, fn func(common.TxIdType) error) error {
+	if tx != 0 {
+		return fn(tx)
+	}
+	tx, err := b.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		b.Rollback(tx)
+		return err
+	}
+	return b.Commit(tx)
+}
+
+// insert adds all the rows of the statement or none of them.
+func insert(b Backend, tx common.TxIdType, st *Insert, args []any) (*Result, error) {
+	res := &Result{}
+	add := func(tx common.TxIdType) error {
+		for _, row := range st.Rows {
+			cols := make(map[string]any, len(row))
+			for i, expr := range row {
+				val, err := Bind(expr, args)
+				if err != nil {
+					return err
+				}
+				if val != nil {
+					cols[st.Columns[i]] = val
+				}
+			}
+			rid, err := b.Insert(tx, st.Table, cols)
+			if err != nil {
+				return err
+			}
+			res.LastId = rid
+			res.Count++
+		}
+		return nil
+	}
+
+	var err error
+	if len(st.Rows) == 1 {
+		err = add(tx)
+	} else {
+		err = within(b, tx, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// change updates or deletes the rows matching the conditions. When some of
+// them can't be expressed as a filter the matching rows are found first and
+// changed one by one, all in one transaction.
+func change(b Backend, tx common.TxIdType, table string, conds []Condition, args []any, fn func(common.TxIdType, common.FilterType) (int, error)) (*Result, error) {
+	w := where{filter: common.FilterType{}}
+	if len(conds) > 0 {
+		columns, err := b.Columns(tx, table)
+		if err != nil {
+			return nil, err
+		}
+		if w, err = planWhere(conds, columns, args); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(w.residual) == 0 {
+		n, err := fn(tx, w.filter)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Count: n}, nil
+	}
+
+	res := &Result{}
+	err := within(b, tx, func(tx common.TxIdType) error {
+		found, err := b.Search(tx, table, w.filter, nil)
+		if err != nil {
+			return err
+		}
+		for _, row := range w.apply(found) {
+			n, err := fn(tx, common.FilterType{IdColumn.Name: {"=" + strconv.FormatUint(uint64(row.Id), 10)}})
+			if err != nil {
+				return err
+			}
+			res.Count += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// selectPlan is a SELECT resolved against the table: the filter the backend
+// searches with, what is left to check on the rows it finds, then how they
+// are sorted, cut and projected.
+type selectPlan struct {
+	table  string
+	output []common.TableColumn
+	where
+	order  []common.SortKey
+	limit  int // -1 when there is no limit
+	offset int
+}
+
+func planSelect(b Backend, tx common.TxIdType, st *Select, args []any) (*selectPlan, error) {
+	columns, err := b.Columns(tx, st.Table)
+	if err != nil {
+		return nil, err
+	}
+	plan := &selectPlan{table: st.Table, limit: -1}
+
+	if st.Columns == nil {
+		plan.output = append([]common.TableColumn{IdColumn}, columns...)
+	}
+	for _, ref := range st.Columns {
+		col, ok := findColumn(columns, ref.Name)
+		if !ok {
+			return nil, errorAtPos(ref.Pos, "unknown column %q", ref.Name)
+		}
+		plan.output = append(plan.output, col)
+	}
+
+	if plan.where, err = planWhere(st.Where, columns, args); err != nil {
+		return nil, err
+	}
+
+	for _, o := range st.OrderBy {
+		col, ok := findColumn(columns, o.Column)
+		if !ok {
+			return nil, errorAtPos(o.Pos, "unknown column %q", o.Column)
+		}
+		plan.order = append(plan.order, common.SortKey{Column: col.Name, Desc: o.Desc})
+	}
+
+	if st.Limit != nil {
+		if plan.limit, err = bindCount(st.Limit, args, "LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	if st.Offset != nil {
+		if plan.offset, err = bindCount(st.Offset, args, "OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func bindCount(e Expr, args []any, clause string) (int, error) {
+	val, err := Bind(e, args)
+	if err != nil {
+		return 0, err
+	}
+	num, err := common.ConvertValue(val, common.NumberColumn)
+	if err != nil || num.(float64) < 0 || num.(float64) != float64(int(num.(float64))) {
+		return 0, fmt.Errorf("%s must be a non-negative integer", clause)
+	}
+	return int(num.(float64)), nil
+}
+
+func (p *selectPlan) run(b Backend, tx common.TxIdType) (*Result, error) {
+	found, err := b.Search(tx, p.table, p.filter, p.order)
+	if err != nil {
+		return nil, err
+	}
+	found = p.apply(found)
+
+	if p.offset >= len(found) {
+		found = nil
+	} else {
+		found = found[p.offset:]
+	}
+	if p.limit >= 0 && p.limit < len(found) {
+		found = found[:p.limit]
+	}
+
+	res := &Result{Columns: p.output, Rows: make([][]any, len(found)), Count: len(found)}
+	for i, row := range found {
+		out := make([]any, len(p.output))
+		for j, col := range p.output {
+			if col == IdColumn {
+				out[j] = row.Id
+			} else {
+				out[j] = row.Columns[col.Name]
+			}
+		}
+		res.Rows[i] = out
+	}
+	return res, nil
+}
+
+// where is a WHERE clause split into the filter of `/row/get` and the
+// conditions it can't express.
+type where struct {
+	filter   common.FilterType
+	residual []predicate
+}
+
+type predicate struct {
+	col   common.TableColumn
+	op    string
+	value any
+	like  *regexp.Regexp
+}
+
+func (w where) apply(rows []common.Row[string]) []common.Row[string] {
+	if len(w.residual) == 0 {
+		return rows
+	}
+	matched := rows[:0]
+	for _, row := range rows {
+		if w.matches(row) {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+func (w where) matches(row common.Row[string]) bool {
+	for _, p := range w.residual {
+		if !p.matches(value(row, p.col)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches compares a value of a row, a missing value never matches.
+func (p predicate) matches(val any) bool {
+	if val == nil {
+		return false
+	}
+	if p.like != nil {
+		return p.like.MatchString(val.(string))
+	}
+	c := common.CompareValues(val, p.value)
+	switch p.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// planWhere pushes the conditions the filter can express to the backend.
+// Conditions on optional columns are always checked on the found rows as
+// the filter lets rows without a value through.
+func planWhere(conds []Condition, columns []common.TableColumn, args []any) (where, error) {
+	w := where{filter: common.FilterType{}}
+	for _, cond := range conds {
+		col, ok := findColumn(columns, cond.Column)
+		if !ok {
+			return w, errorAtPos(cond.Pos, "unknown column %q", cond.Column)
+		}
+		val, err := Bind(cond.Value, args)
+		if err != nil {
+			return w, errorAtPos(cond.Pos, "%s", err)
+		}
+		if val == nil {
+			return w, errorAtPos(cond.Pos, "%s: comparison with NULL is not supported", cond.Column)
+		}
+		if cond.Op == "LIKE" {
+			if col.Type != common.StringColumn {
+				return w, errorAtPos(cond.Pos, "%s: LIKE is not supported for %s columns",
+					cond.Column, common.ColumnsTypeEnum[col.Type])
+			}
+		} else if col.Type == common.BoolColumn && cond.Op != "=" && cond.Op != "!=" {
+			return w, errorAtPos(cond.Pos, "%s: %s is not supported for bool columns", cond.Column, cond.Op)
+		}
+
+		converted, err := common.ConvertValue(val, col.Type)
+		if err != nil {
+			return w, errorAtPos(cond.Pos, "%s: %s", cond.Column, err)
+		}
+		if col == IdColumn {
+			if id := converted.(float64); id < 0 || id != float64(uint64(id)) {
+				return w, errorAtPos(cond.Pos, "row id must be a non-negative integer")
+			}
+		}
+
+		if op, text, ok := pushdown(col, cond.Op, converted); ok && !col.IsOptional {
+			w.filter[col.Name] = append(w.filter[col.Name], op+text)
+			continue
+		}
+		p := predicate{col: col, op: cond.Op, value: converted}
+		if cond.Op == "LIKE" {
+			p.like = likePattern(converted.(string))
+		}
+		w.residual = append(w.residual, p)
+	}
+	return w, nil
+}
+
+// pushdown returns the filter operator and operand of a condition, numbers
+// can be compared in the filter, strings only matched by LIKE patterns
+// without wildcards inside.
+func pushdown(col common.TableColumn, op string, val any) (string, string, bool) {
+	var text string
+	switch v := val.(type) {
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = strconv.FormatBool(v)
+	case string:
+		text = v
+	}
+
+	switch {
+	case op == "=" || op == "!=":
+		return op, text, true
+	case col.Type == common.NumberColumn && (op == "<" || op == ">" || op == "<=" || op == ">="):
+		return op, text, true
+	case op == "LIKE":
+		return likeOperator(text)
+	}
+	return "", "", false
+}
+
+// likeOperator maps 'abc', 'abc%', '%abc' and '%abc%' to the equal, prefix,
+// suffix and contain operators of the filter.
+func likeOperator(pattern string) (string, string, bool) {
+	prefix := strings.HasPrefix(pattern, "%")
+	suffix := strings.HasSuffix(pattern, "%") && len(pattern) > 1
+	text := strings.TrimSuffix(strings.TrimPrefix(pattern, "%"), "%")
+	if strings.ContainsAny(text, "%_") {
+		return "", "", false
+	}
+	switch {
+	case prefix && suffix:
+		return "*=", text, true
+	case prefix:
+		return "$=", text, true
+	case suffix:
+		return "^=", text, true
+	}
+	return "=", text, true
+}
+
+// likePattern compiles a LIKE pattern, % matches any text and _ a single
+// character.
+func likePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+func findColumn(columns []common.TableColumn, name string) (common.TableColumn, bool) {
+	if name == IdColumn.Name {
+		return IdColumn, true
+	}
+	for _, col := range columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return common.TableColumn{}, false
+}
+
+func value(row common.Row[string], col common.TableColumn) any {
+	if col == IdColumn {
+		return float64(row.Id)
+	}
+	return row.Columns[col.Name]
+}
@@ -0,0 +1,58 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/idkarn/curiodb/pkg/common"
+)
+
+// tableBackend keeps the tables created and fails to add the column named
+// fail.
+type tableBackend struct {
+	Backend
+	tables map[string][]string
+	fail   string
+}
+
+func (b *tableBackend) CreateTable(name string) error {
+	b.tables[name] = []string{}
+	return nil
+}
+
+func (b *tableBackend) DropTable(name string) error {
+	delete(b.tables, name)
+	return nil
+}
+
+func (b *tableBackend) AddColumn(_ common.TxIdType, table string, col ColumnDef) error {
+	if col.Name == b.fail {
+		return errors.New("column can't be added")
+	}
+	b.tables[table] = append(b.tables[table], col.Name)
+	return nil
+}
+
+func TestCreateTableDroppedOnError(t *testing.T) {
+	b := &tableBackend{tables: map[string][]string{}, fail: "b"}
+	q, err := Parse("CREATE TABLE t (a NUMBER, b STRING)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Execute(b, 0, q, nil); err == nil {
+		t.Fatal("expected the column b to fail")
+	}
+	if len(b.tables) != 0 {
+		t.Fatalf("expected: no tables, but returned %+v", b.tables)
+	}
+
+	b.fail = ""
+	if _, err := Execute(b, 0, q, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"t": {"a", "b"}}
+	if !reflect.DeepEqual(b.tables, expected) {
+		t.Fatalf("expected: %+v, but returned %+v", expected, b.tables)
+	}
+}
@@ -7,42 +7,47 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/idkarn/curiodb/pkg/api"
 	"github.com/idkarn/curiodb/pkg/common"
 	mw "github.com/idkarn/curiodb/pkg/middleware"
 )
 
+const DefaultSnapshotInterval = common.DEFAULT_SNAPSHOT_INTERVAL
+const DefaultSnapshotEvery = common.DEFAULT_SNAPSHOT_EVERY
+
 type DBConfig struct {
-	PORT uint32
+	PORT             uint32
+	DataDir          string
+	SnapshotInterval time.Duration
+	SnapshotEvery    uint64
+	TxTimeout        time.Duration
 }
 
 func NewConfig(port uint32) DBConfig {
 	if port < 1024 || port > 49151 {
 		panic(fmt.Sprintf("Port %d is not allowed", port))
 	}
-	return DBConfig{port}
+	return DBConfig{
+		PORT:             port,
+		DataDir:          common.DEFAULT_DATA_DIR,
+		SnapshotInterval: DefaultSnapshotInterval,
+		SnapshotEvery:    DefaultSnapshotEvery,
+		TxTimeout:        common.DEFAULT_TX_TIMEOUT,
+	}
 }
 
-func loadData(port uint32) {
-	ok, data := common.Load()
-	if ok {
-		log.Println("Data was successsfully loaded")
-		common.Config(common.DatabaseStore{
-			Tables:         data.Tables,
-			TablesMetaData: data.TablesMetaData,
-		})
-	} else {
-		log.Println("Load data failed")
-		common.Config(common.DatabaseStore{
-			Tables: []common.Table{
-				{},
-			},
-			TablesMetaData: []common.TableMetaData{
-				{},
-			},
-		})
+func loadData(config DBConfig) {
+	db, err := common.Open(config.DataDir, common.Options{
+		SnapshotInterval: config.SnapshotInterval,
+		SnapshotEvery:    config.SnapshotEvery,
+		TxTimeout:        config.TxTimeout,
+	})
+	if err != nil {
+		log.Fatalf("Load data failed: %s\n", err)
 	}
+	common.Default = db
 }
 
 func initRouter() {
@@ -53,6 +58,22 @@ func initRouter() {
 		mw.NewRouteInfo("POST", "/row/get", api.GetRowHandler),
 		mw.NewRouteInfo("POST", "/row/update", api.UpdateRowHandler),
 		mw.NewRouteInfo("POST", "/row/delete", api.DeleteRowHandler),
+		mw.NewRouteInfo("POST", "/row/aggregate", api.AggregateHandler),
+		mw.NewRouteInfo("POST", "/row/upsert", api.UpsertRowHandler),
+		mw.NewRouteInfo("POST", "/row/bulk", api.BulkInsertHandler),
+		mw.NewRouteInfo("POST", "/index/new", api.NewIndexHandler),
+		mw.NewRouteInfo("POST", "/index/drop", api.DropIndexHandler),
+		mw.NewRouteInfo("POST", "/table/new", api.NewTableHandler),
+		mw.NewRouteInfo("GET", "/table/list", api.ListTablesHandler),
+		mw.NewRouteInfo("POST", "/table/rename", api.RenameTableHandler),
+		mw.NewRouteInfo("POST", "/table/drop", api.DropTableHandler),
+		mw.NewRouteInfo("GET", "/table/export", api.ExportTableHandler),
+		mw.NewRouteInfo("POST", "/table/import", api.ImportTableHandler),
+		mw.NewRouteInfo("GET", "/admin/snapshot", api.SnapshotInfoHandler),
+		mw.NewRouteInfo("POST", "/tx/begin", api.TxBeginHandler),
+		mw.NewRouteInfo("POST", "/tx/commit", api.TxCommitHandler),
+		mw.NewRouteInfo("POST", "/tx/rollback", api.TxRollbackHandler),
+		mw.NewRouteInfo("POST", "/query", api.QueryHandler),
 	})
 
 	mw.SetupMiddlewares([]mw.MiddlewareFn{
@@ -74,7 +95,7 @@ func Launch(config DBConfig) {
 		Terminate()
 	}()
 
-	loadData(config.PORT)
+	loadData(config)
 	initRouter()
 
 	log.Printf("curiodb is running on port %d\n", config.PORT)
@@ -83,7 +104,9 @@ func Launch(config DBConfig) {
 }
 
 func Terminate() {
-	common.Dump()
+	if err := common.Default.Close(); err != nil {
+		log.Println(err)
+	}
 	log.Println("curiodb is stopped")
 	os.Exit(0)
 }